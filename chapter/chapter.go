@@ -0,0 +1,121 @@
+package chapter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// numberRegexp matches chapter numbers, only decimal digits: strconv also
+// parses "inf", "nan", "1e3" or "0x1p4", which are names of chapters
+var numberRegexp = regexp.MustCompile(`^\d+(\.\d+)?$`)
+
+// ID identifies a chapter of a series. It is either a number such as "10"
+// or "10.5", or a name such as "oneshot" for chapters without a number.
+type ID string
+
+// Parse returns the ID of a chapter number or name. Numbers are normalized,
+// so that "010" and "10.50" are both the same chapter as "10" and "10.5".
+func Parse(s string) (ID, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", fmt.Errorf("empty chapter")
+	}
+	if strings.ContainsAny(s, "/\\ \t\n") {
+		return "", fmt.Errorf("invalid chapter %q", s)
+	}
+
+	/* normalize numbers, keeping names as they are */
+	if strings.HasPrefix(s, "-") && numberRegexp.MatchString(s[1:]) {
+		return "", fmt.Errorf("invalid chapter %q", s)
+	}
+	if numberRegexp.MatchString(s) {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid chapter %q", s)
+		}
+		return ID(strconv.FormatFloat(f, 'f', -1, 64)), nil
+	}
+	return ID(strings.ToLower(s)), nil
+}
+
+// FromInt returns the ID of chapter n
+func FromInt(n int) ID {
+	return ID(strconv.Itoa(n))
+}
+
+// Slug returns the ID of a chapter name, e.g. "extra-story" for "Extra Story!"
+func Slug(name string) ID {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return ID(b.String())
+}
+
+// Number returns the value of a numbered chapter
+func (id ID) Number() (float64, bool) {
+	if !numberRegexp.MatchString(string(id)) {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(string(id), 64)
+	return f, err == nil
+}
+
+// IsNumber reports whether the chapter is numbered
+func (id ID) IsNumber() bool {
+	_, ok := id.Number()
+	return ok
+}
+
+// Pad returns the ID with its integer part padded with zeros to width
+// digits, e.g. "010.5" for Pad(3) of chapter 10.5. Names are not padded.
+// Padded IDs of numbered chapters sort in the same order as their numbers.
+func (id ID) Pad(width int) string {
+	if !id.IsNumber() {
+		return string(id)
+	}
+	integer, fraction := string(id), ""
+	if dot := strings.IndexByte(integer, '.'); dot >= 0 {
+		integer, fraction = integer[:dot], integer[dot:]
+	}
+	for len(integer) < width {
+		integer = "0" + integer
+	}
+	return integer + fraction
+}
+
+func (id ID) String() string {
+	return string(id)
+}
+
+// Less orders numbered chapters by number, followed by named chapters by name
+func Less(a, b ID) bool {
+	na, aok := a.Number()
+	nb, bok := b.Number()
+	switch {
+	case aok && bok:
+		return na < nb
+	case aok != bok:
+		return aok
+	}
+	return a < b
+}
+
+// Sort sorts ids in the order of Less
+func Sort(ids []ID) {
+	sort.SliceStable(ids, func(i, j int) bool {
+		return Less(ids[i], ids[j])
+	})
+}
@@ -0,0 +1,75 @@
+package chapter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for input, expect := range map[string]ID{
+		"10":      "10",
+		"010":     "10",
+		"10.5":    "10.5",
+		"10.50":   "10.5",
+		" 3 ":     "3",
+		"Oneshot": "oneshot",
+		"inf":     "inf",
+		"NaN":     "nan",
+		"1e3":     "1e3",
+		"0x1p4":   "0x1p4",
+	} {
+		if got, err := Parse(input); err != nil || got != expect {
+			t.Errorf("%q: got %q %v, expect %q", input, got, err, expect)
+		}
+	}
+
+	for _, input := range []string{"", "-1", "a/b", "extra 1"} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("%q: no error", input)
+		}
+	}
+}
+
+func TestIsNumber(t *testing.T) {
+	for id, expect := range map[ID]bool{
+		"10":       true,
+		"10.5":     true,
+		"infinity": false,
+		"nan":      false,
+		"1e3":      false,
+		"0x1p4":    false,
+		"10.":      false,
+	} {
+		if got := id.IsNumber(); got != expect {
+			t.Errorf("%q: got %v, expect %v", id, got, expect)
+		}
+	}
+}
+
+func TestSlug(t *testing.T) {
+	if got := Slug("  Extra Story: Part 2! "); got != "extra-story-part-2" {
+		t.Errorf("Got: %q", got)
+	}
+}
+
+func TestPad(t *testing.T) {
+	for id, expect := range map[ID]string{
+		"1":       "001",
+		"10.5":    "010.5",
+		"1234":    "1234",
+		"oneshot": "oneshot",
+	} {
+		if got := id.Pad(3); got != expect {
+			t.Errorf("%q: got %q, expect %q", id, got, expect)
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	ids := []ID{"oneshot", "10", "9", "extra", "10.5", "1"}
+	Sort(ids)
+	expect := []ID{"1", "9", "10", "10.5", "extra", "oneshot"}
+	if !reflect.DeepEqual(expect, ids) {
+		t.Errorf("Got: %v, expect: %v", ids, expect)
+	}
+}
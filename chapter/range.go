@@ -0,0 +1,270 @@
+package chapter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Range is a parsed chapter range expression, a comma separated list of:
+//
+//	8         a single chapter, e.g. 8, 10.5 or oneshot
+//	1-5       chapters 1 to 5 inclusive
+//	12-       chapter 12 up to the latest chapter, also written 12..
+//	all       every chapter of the series
+//	latest    the latest chapter
+//	latest-N  the latest N chapters
+//
+// Chapter names are letters, digits and dashes, starting with a letter.
+type Range struct {
+	items []rangeItem
+}
+
+type itemKind int
+
+const (
+	single itemKind = iota
+	closed
+	open
+	all
+	latest
+)
+
+type rangeItem struct {
+	kind     itemKind
+	from, to ID
+	count    int
+}
+
+// ParseRange parses a chapter range expression such as "1-5,8,10.5,12-"
+func ParseRange(expr string) (Range, error) {
+	var r Range
+	for _, field := range strings.Split(expr, ",") {
+		field = strings.TrimSpace(field)
+		item, err := parseItem(field)
+		if err != nil {
+			return Range{}, fmt.Errorf("invalid chapter range %q: %v", expr, err)
+		}
+		r.items = append(r.items, item)
+	}
+	return r, nil
+}
+
+func parseItem(field string) (rangeItem, error) {
+	switch {
+	case field == "":
+		return rangeItem{}, fmt.Errorf("empty chapter")
+
+	case field == "all":
+		return rangeItem{kind: all}, nil
+
+	case field == "latest":
+		return rangeItem{kind: latest, count: 1}, nil
+
+	case strings.HasPrefix(field, "latest-"):
+		n, err := strconv.Atoi(strings.TrimPrefix(field, "latest-"))
+		if err != nil || n < 1 {
+			return rangeItem{}, fmt.Errorf("invalid chapter count in %q", field)
+		}
+		return rangeItem{kind: latest, count: n}, nil
+
+	case strings.HasSuffix(field, ".."):
+		from, err := parseNumber(strings.TrimSuffix(field, ".."))
+		if err != nil {
+			return rangeItem{}, err
+		}
+		return rangeItem{kind: open, from: from}, nil
+	}
+
+	/* a dash after a number is a range, otherwise it is part of a name */
+	dash := strings.IndexByte(field, '-')
+	if dash < 0 {
+		id, err := parseChapter(field)
+		return rangeItem{kind: single, from: id, to: id}, err
+	}
+	from, err := parseNumber(field[:dash])
+	if err != nil {
+		id, err := parseChapter(field)
+		return rangeItem{kind: single, from: id, to: id}, err
+	}
+	if field[dash+1:] == "" {
+		return rangeItem{kind: open, from: from}, nil
+	}
+	to, err := parseNumber(field[dash+1:])
+	if err != nil {
+		return rangeItem{}, err
+	}
+	if Less(to, from) {
+		return rangeItem{}, fmt.Errorf("chapter %s is after chapter %s", from, to)
+	}
+	return rangeItem{kind: closed, from: from, to: to}, nil
+}
+
+// parseChapter parses a single chapter, rejecting names that look like a
+// mistyped number or range, such as "3x", "1.5.2" or "1..5"
+func parseChapter(s string) (ID, error) {
+	id, err := Parse(s)
+	if err != nil || id.IsNumber() {
+		return id, err
+	}
+	if name := string(id); name[0] < 'a' || name[0] > 'z' || Slug(name) != id {
+		return "", fmt.Errorf("invalid chapter %q, need a number or a name such as oneshot", s)
+	}
+	return id, nil
+}
+
+func parseNumber(s string) (ID, error) {
+	id, err := Parse(s)
+	if err != nil {
+		return "", err
+	}
+	if !id.IsNumber() {
+		return "", fmt.Errorf("%q is not a chapter number", s)
+	}
+	return id, nil
+}
+
+// NeedsIndex reports whether the range can only be resolved with the chapter
+// list of the series, i.e. it is open-ended or refers to the latest chapter
+func (r Range) NeedsIndex() bool {
+	for _, item := range r.items {
+		if item.kind == open || item.kind == all || item.kind == latest {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the chapters in the range, sorted and without duplicates.
+// available is the chapter list of the series, or nil if it is unknown.
+//
+// With a chapter list, only chapters that exist are selected: ranges include
+// fractional chapters such as 10.5, and a single chapter that does not exist
+// is an error. Without it, ranges are expanded to every integer between
+// their bounds.
+func (r Range) Resolve(available []ID) ([]ID, error) {
+	if available == nil && r.NeedsIndex() {
+		return nil, fmt.Errorf("open-ended and latest ranges need the chapter list of the series")
+	}
+
+	var numbered []ID
+	exists := make(map[ID]bool)
+	for _, id := range available {
+		exists[id] = true
+		if id.IsNumber() {
+			numbered = append(numbered, id)
+		}
+	}
+	Sort(numbered)
+
+	var ids []ID
+	for _, item := range r.items {
+		switch item.kind {
+		case single:
+			if available != nil && !exists[item.from] {
+				return nil, fmt.Errorf("chapter %s not found", item.from)
+			}
+			ids = append(ids, item.from)
+
+		case closed:
+			if available == nil {
+				expanded, err := expand(item.from, item.to)
+				if err != nil {
+					return nil, err
+				}
+				ids = append(ids, expanded...)
+				continue
+			}
+			found := between(numbered, item.from, item.to)
+			if len(found) == 0 {
+				return nil, fmt.Errorf("no chapters found from %s to %s", item.from, item.to)
+			}
+			ids = append(ids, found...)
+
+		case open:
+			if len(numbered) == 0 {
+				return nil, fmt.Errorf("no numbered chapters found")
+			}
+			found := between(numbered, item.from, numbered[len(numbered)-1])
+			if len(found) == 0 {
+				return nil, fmt.Errorf("chapter %s is after the latest chapter %s", item.from, numbered[len(numbered)-1])
+			}
+			ids = append(ids, found...)
+
+		case all:
+			ids = append(ids, available...)
+
+		case latest:
+			if len(numbered) == 0 {
+				return nil, fmt.Errorf("no numbered chapters found")
+			}
+			n := item.count
+			if n > len(numbered) {
+				n = len(numbered)
+			}
+			ids = append(ids, numbered[len(numbered)-n:]...)
+		}
+	}
+
+	/* sort and remove duplicates of overlapping items */
+	Sort(ids)
+	var chapters []ID
+	for i, id := range ids {
+		if i == 0 || id != ids[i-1] {
+			chapters = append(chapters, id)
+		}
+	}
+	return chapters, nil
+}
+
+/* between returns the chapters from sorted numbered chapters within [from, to] */
+func between(numbered []ID, from, to ID) []ID {
+	var ids []ID
+	for _, id := range numbered {
+		if !Less(id, from) && !Less(to, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+/* expand returns every integer chapter from from to to */
+func expand(from, to ID) ([]ID, error) {
+	first, err := strconv.Atoi(string(from))
+	if err != nil {
+		return nil, fmt.Errorf("range from %s to %s needs the chapter list of the series", from, to)
+	}
+	last, err := strconv.Atoi(string(to))
+	if err != nil {
+		return nil, fmt.Errorf("range from %s to %s needs the chapter list of the series", from, to)
+	}
+	var ids []ID
+	for i := first; i <= last; i++ {
+		ids = append(ids, FromInt(i))
+	}
+	return ids, nil
+}
+
+// Contains reports whether chapter id is in the range, without the chapter
+// list of the series: latest chapters are never contained.
+func (r Range) Contains(id ID) bool {
+	for _, item := range r.items {
+		switch item.kind {
+		case single:
+			if id == item.from {
+				return true
+			}
+		case closed:
+			if id.IsNumber() && !Less(id, item.from) && !Less(item.to, id) {
+				return true
+			}
+		case open:
+			if id.IsNumber() && !Less(id, item.from) {
+				return true
+			}
+		case all:
+			return true
+		}
+	}
+	return false
+}
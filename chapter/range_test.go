@@ -0,0 +1,68 @@
+package chapter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	for _, expr := range []string{"", "1,,2", "5-1", "1-x", "latest-0", "latest-x", "x..", "-1", "1/2", "inf..", "1-inf", "0-nan", "1..5", "3x", "1.5.2", "1-5x", "extra!"} {
+		if _, err := ParseRange(expr); err == nil {
+			t.Errorf("%q: no error", expr)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	available := []ID{"1", "2", "3", "3.5", "4", "5", "8", "10", "10.5", "12", "13", "extra-1"}
+
+	for _, c := range []struct {
+		expr      string
+		available []ID
+		expect    []ID
+	}{
+		{"1-5,8,10.5,12-", available, []ID{"1", "2", "3", "3.5", "4", "5", "8", "10.5", "12", "13"}},
+		{"1-5,8,10.5,12-", available[:0], nil},
+		{"12..", available, []ID{"12", "13"}},
+		{"latest", available, []ID{"13"}},
+		{"latest-3,1", available, []ID{"1", "10.5", "12", "13"}},
+		{"all", available, available},
+		{"extra-1,2-3.5,3", available, []ID{"2", "3", "3.5", "extra-1"}},
+		{"1-5,8,10.5", nil, []ID{"1", "2", "3", "4", "5", "8", "10.5"}},
+		{"oneshot,2", nil, []ID{"2", "oneshot"}},
+		{"latest", []ID{"1", "2", "infinity"}, []ID{"2"}},
+	} {
+		r, err := ParseRange(c.expr)
+		if err != nil {
+			t.Errorf("%q: %v", c.expr, err)
+			continue
+		}
+		got, err := r.Resolve(c.available)
+		if c.expect == nil {
+			if err == nil {
+				t.Errorf("%q: no error", c.expr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("%q: got %v %v, expect %v", c.expr, got, err, c.expect)
+		}
+	}
+
+	for _, c := range []struct {
+		expr      string
+		available []ID
+	}{
+		{"12-", nil},
+		{"latest", nil},
+		{"1.5-3", nil},
+		{"7", available},
+		{"6-7", available},
+		{"14-", available},
+	} {
+		r, _ := ParseRange(c.expr)
+		if _, err := r.Resolve(c.available); err == nil {
+			t.Errorf("%q: no error", c.expr)
+		}
+	}
+}
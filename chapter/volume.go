@@ -0,0 +1,62 @@
+package chapter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Volumes maps chapters to volumes, parsed from lines of
+//
+//	<volume>: <chapter range>
+//
+// such as "2: 10-18,extra-1". Blank lines and lines starting with # are
+// ignored.
+type Volumes struct {
+	volumes []string
+	ranges  []Range
+}
+
+// ParseVolumes reads a chapter to volume mapping
+func ParseVolumes(r io.Reader) (Volumes, error) {
+	var v Volumes
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		colon := strings.IndexByte(text, ':')
+		if colon < 0 {
+			return Volumes{}, fmt.Errorf("line %d: need <volume>: <chapters>", line)
+		}
+		volume, err := Parse(text[:colon])
+		if err != nil {
+			return Volumes{}, fmt.Errorf("line %d: invalid volume: %v", line, err)
+		}
+		chapters, err := ParseRange(text[colon+1:])
+		if err != nil {
+			return Volumes{}, fmt.Errorf("line %d: %v", line, err)
+		}
+		for _, item := range chapters.items {
+			if item.kind == latest {
+				return Volumes{}, fmt.Errorf("line %d: latest chapters cannot be mapped to a volume", line)
+			}
+		}
+		v.volumes = append(v.volumes, string(volume))
+		v.ranges = append(v.ranges, chapters)
+	}
+	return v, scanner.Err()
+}
+
+// Volume returns the volume of chapter id, the first one listing it
+func (v Volumes) Volume(id ID) (string, bool) {
+	for i, r := range v.ranges {
+		if r.Contains(id) {
+			return v.volumes[i], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,41 @@
+package chapter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVolumes(t *testing.T) {
+	v, err := ParseVolumes(strings.NewReader(`
+# volume: chapters
+1: 1-9
+02: 9.5,10-18, extra-1
+
+3: 19-
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id, expect := range map[ID]string{
+		"1":       "1",
+		"9":       "1",
+		"9.5":     "2",
+		"18":      "2",
+		"extra-1": "2",
+		"100":     "3",
+	} {
+		if got, ok := v.Volume(id); !ok || got != expect {
+			t.Errorf("%s: got %q %v, expect %q", id, got, ok, expect)
+		}
+	}
+	if got, ok := v.Volume("oneshot"); ok {
+		t.Errorf("oneshot: got %q", got)
+	}
+
+	for _, input := range []string{"1 1-9", "x/y: 1", "1: 5-1", "1: latest"} {
+		if _, err := ParseVolumes(strings.NewReader(input)); err == nil {
+			t.Errorf("%q: no error", input)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"archive/zip"
 	"io/ioutil"
 	"log"
+	"mangadl/comicinfo"
 	"os"
 	"sync"
 )
@@ -23,6 +24,11 @@ func readZip(fileName string, contents chan<- zipFile, wg *sync.WaitGroup) {
 
 	/* loop through all contents */
 	for _, f := range r.File {
+		/* the metadata of every input only counts its own pages */
+		if f.Name == comicinfo.FileName {
+			continue
+		}
+
 		rc, err := f.Open()
 		if err != nil {
 			log.Fatal(err)
@@ -80,8 +86,8 @@ func combineCBZchan(cbzName string, contents <-chan zipFile, wgCBZ *sync.WaitGro
 	wgCBZ.Done()
 }
 
-func Combine() {
-	args := os.Args[2:]
+// Combine merges the cbz files args[1:] into a new cbz file args[0]
+func Combine(args []string) {
 	log.Println("Args: ", args)
 
 	contents := make(chan zipFile)
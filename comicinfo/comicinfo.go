@@ -0,0 +1,90 @@
+package comicinfo
+
+import (
+	"encoding/xml"
+	"mangadl/imagetype"
+	"strings"
+)
+
+// FileName is the name of the ComicInfo entry of an archive
+const FileName = "ComicInfo.xml"
+
+// Values of the Manga element
+const (
+	MangaYes         = "Yes"
+	MangaRightToLeft = "YesAndRightToLeft"
+	MangaNo          = "No"
+)
+
+// Values of the Type attribute of a page
+const (
+	PageFrontCover = "FrontCover"
+	PageStory      = "Story"
+)
+
+// ComicInfo is the metadata of an archive, in the ComicInfo.xml format of
+// ComicRack (schema 2.0), also read by Komga and Kavita. Empty elements are
+// left out.
+type ComicInfo struct {
+	XMLName     xml.Name `xml:"ComicInfo"`
+	XSD         string   `xml:"xmlns:xsd,attr"`
+	XSI         string   `xml:"xmlns:xsi,attr"`
+	Title       string   `xml:"Title,omitempty"`
+	Series      string   `xml:"Series,omitempty"`
+	Number      string   `xml:"Number,omitempty"`
+	Volume      string   `xml:"Volume,omitempty"`
+	Summary     string   `xml:"Summary,omitempty"`
+	Writer      string   `xml:"Writer,omitempty"`
+	Genre       string   `xml:"Genre,omitempty"`
+	Web         string   `xml:"Web,omitempty"`
+	PageCount   int      `xml:"PageCount"`
+	LanguageISO string   `xml:"LanguageISO,omitempty"`
+	Manga       string   `xml:"Manga,omitempty"`
+	Pages       []Page   `xml:"Pages>Page"`
+}
+
+// Page is the metadata of a page of an archive
+type Page struct {
+	Image       int    `xml:"Image,attr"`
+	Type        string `xml:"Type,attr,omitempty"`
+	ImageSize   int    `xml:"ImageSize,attr,omitempty"`
+	ImageWidth  int    `xml:"ImageWidth,attr,omitempty"`
+	ImageHeight int    `xml:"ImageHeight,attr,omitempty"`
+}
+
+// List joins names, such as authors or genres, as a ComicInfo list
+func List(names []string) string {
+	return strings.Join(names, ", ")
+}
+
+// NewPage returns the metadata of a page, with the size of its image when
+// it is known
+func NewPage(data []byte) Page {
+	page := Page{Type: PageStory, ImageSize: len(data)}
+	page.ImageWidth, page.ImageHeight, _ = imagetype.Size(data)
+	return page
+}
+
+// SetPages sets the pages of the archive, in reading order. The first page
+// is the front cover.
+func (c *ComicInfo) SetPages(pages []Page) {
+	c.Pages = pages
+	for i := range c.Pages {
+		c.Pages[i].Image = i
+	}
+	if len(c.Pages) > 0 {
+		c.Pages[0].Type = PageFrontCover
+	}
+	c.PageCount = len(c.Pages)
+}
+
+// Marshal returns the ComicInfo.xml document
+func (c *ComicInfo) Marshal() ([]byte, error) {
+	c.XSD = "http://www.w3.org/2001/XMLSchema"
+	c.XSI = "http://www.w3.org/2001/XMLSchema-instance"
+	data, err := xml.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
@@ -0,0 +1,48 @@
+package comicinfo
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestMarshal(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 20, 30)))
+
+	info := &ComicInfo{
+		Series:      "Naruto",
+		Number:      "10.5",
+		Writer:      List([]string{"Kishimoto Masashi"}),
+		Genre:       List([]string{"Action", "Shounen"}),
+		LanguageISO: "en",
+		Manga:       MangaRightToLeft}
+	info.SetPages([]Page{NewPage(buf.Bytes()), NewPage([]byte("not an image"))})
+
+	data, err := info.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	for _, expect := range []string{
+		`<?xml version="1.0" encoding="UTF-8"?>`,
+		`<ComicInfo xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">`,
+		`<Series>Naruto</Series>`,
+		`<Number>10.5</Number>`,
+		`<Genre>Action, Shounen</Genre>`,
+		`<PageCount>2</PageCount>`,
+		`<Manga>YesAndRightToLeft</Manga>`,
+		`<Page Image="0" Type="FrontCover" ImageSize="`,
+		`ImageWidth="20" ImageHeight="30"></Page>`,
+		`<Page Image="1" Type="Story" ImageSize="12"></Page>`,
+	} {
+		if !strings.Contains(got, expect) {
+			t.Errorf("Missing %s in:\n%s", expect, got)
+		}
+	}
+	if strings.Contains(got, "<Summary>") {
+		t.Errorf("Empty element in:\n%s", got)
+	}
+}
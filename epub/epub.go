@@ -0,0 +1,252 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mangadl/imagetype"
+	"path"
+	"sort"
+	"time"
+)
+
+// Metadata is the metadata of a book
+type Metadata struct {
+	Title       string
+	Authors     []string
+	Description string
+	Language    string
+	// Identifier is unique to the book, e.g. a UUID of the URL of the
+	// series and its chapters. It defaults to the UUID of the title.
+	Identifier  string
+	RightToLeft bool
+	Modified    time.Time
+}
+
+// Writer writes a fixed layout EPUB 3 book of one image per page. The pages
+// may be added in any order, they are sorted by name when the book is closed.
+// Metadata is written when the book is closed too, so that it can be
+// completed once the pages are known.
+type Writer struct {
+	Metadata Metadata
+	zip      *zip.Writer
+	pages    []page
+}
+
+type page struct {
+	name          string
+	chapter       string
+	mediaType     string
+	width, height int
+}
+
+// Default size of the pages whose image size is unknown
+const (
+	defaultWidth  = 1200
+	defaultHeight = 1800
+)
+
+// NewWriter starts a book written to w
+func NewWriter(w io.Writer, metadata Metadata) (*Writer, error) {
+	if metadata.Modified.IsZero() {
+		metadata.Modified = time.Now()
+	}
+	writer := &Writer{Metadata: metadata, zip: zip.NewWriter(w)}
+
+	/* the mimetype comes first and uncompressed, so that the book is recognized */
+	if err := writer.create("mimetype", zip.Store, []byte("application/epub+zip")); err != nil {
+		return nil, err
+	}
+	if err := writer.create("META-INF/container.xml", zip.Deflate, []byte(container)); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (w *Writer) create(name string, method uint16, data []byte) error {
+	header := zip.FileHeader{Name: name, Method: method}
+	header.SetModTime(w.Metadata.Modified)
+	f, err := w.zip.CreateHeader(&header)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// AddPage adds the image of a page. chapter is the title of the chapter of
+// the page in the table of contents.
+func (w *Writer) AddPage(name, chapter string, data []byte) error {
+	t, err := imagetype.Sniff(data)
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	p := page{name: path.Base(name), chapter: chapter, mediaType: t.MIME}
+	if p.width, p.height, err = imagetype.Size(data); err != nil {
+		p.width, p.height = defaultWidth, defaultHeight
+	}
+	w.pages = append(w.pages, p)
+	return w.create("OEBPS/images/"+p.name, zip.Store, data)
+}
+
+// Close writes the pages, package document and table of contents, and
+// closes the archive. It does not close the underlying writer. A book
+// without pages is an error, its spine would be empty.
+func (w *Writer) Close() error {
+	if len(w.pages) == 0 {
+		return fmt.Errorf("book without pages")
+	}
+	if w.Metadata.Language == "" {
+		w.Metadata.Language = "en"
+	}
+	if w.Metadata.Identifier == "" {
+		w.Metadata.Identifier = UUID(w.Metadata.Title)
+	}
+	sort.Slice(w.pages, func(i, j int) bool {
+		return w.pages[i].name < w.pages[j].name
+	})
+	for i, p := range w.pages {
+		if err := w.create("OEBPS/"+pageFile(i), zip.Deflate, pageXHTML(p)); err != nil {
+			return err
+		}
+	}
+	if err := w.create("OEBPS/nav.xhtml", zip.Deflate, w.nav()); err != nil {
+		return err
+	}
+	if err := w.create("OEBPS/content.opf", zip.Deflate, w.opf()); err != nil {
+		return err
+	}
+	return w.zip.Close()
+}
+
+func pageFile(i int) string {
+	return fmt.Sprintf("pages/page-%04d.xhtml", i+1)
+}
+
+// escape returns s escaped for XML text and attributes
+func escape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+const container = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+func pageXHTML(p page) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head>
+  <title>%s</title>
+  <meta name="viewport" content="width=%d, height=%d"/>
+  <style>html, body { margin: 0; padding: 0; } img { display: block; width: 100%%; height: 100%%; }</style>
+</head>
+<body>
+  <img src="../images/%s" alt=""/>
+</body>
+</html>
+`, escape(p.chapter), p.width, p.height, escape(p.name))
+	return buf.Bytes()
+}
+
+// nav returns the table of contents, an entry at the first page of every
+// chapter
+func (w *Writer) nav() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head>
+  <title>%s</title>
+</head>
+<body>
+  <nav epub:type="toc" id="toc">
+    <ol>
+`, escape(w.Metadata.Title))
+	for i, p := range w.pages {
+		if i == 0 || p.chapter != w.pages[i-1].chapter {
+			fmt.Fprintf(&buf, "      <li><a href=\"%s\">%s</a></li>\n", pageFile(i), escape(p.chapter))
+		}
+	}
+	buf.WriteString(`    </ol>
+  </nav>
+</body>
+</html>
+`)
+	return buf.Bytes()
+}
+
+// urlNamespace is the namespace of name-based UUIDs of URLs, from RFC 4122
+var urlNamespace = []byte{0x6b, 0xa7, 0xb8, 0x11, 0x9d, 0xad, 0x11, 0xd1, 0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8}
+
+// UUID returns a urn:uuid identifier derived from name, a version 5 UUID in
+// the URL namespace, so that the same book always gets the same identifier
+func UUID(name string) string {
+	h := sha1.New()
+	h.Write(urlNamespace)
+	h.Write([]byte(name))
+	u := h.Sum(nil)[:16]
+	u[6] = u[6]&0x0f | 0x50
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// opf returns the package document
+func (w *Writer) opf() []byte {
+	m := w.Metadata
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" prefix="rendition: http://www.idpf.org/vocab/rendition/#">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">%s</dc:identifier>
+    <dc:title>%s</dc:title>
+    <dc:language>%s</dc:language>
+`, escape(m.Identifier), escape(m.Title), escape(m.Language))
+	for _, author := range m.Authors {
+		fmt.Fprintf(&buf, "    <dc:creator>%s</dc:creator>\n", escape(author))
+	}
+	if m.Description != "" {
+		fmt.Fprintf(&buf, "    <dc:description>%s</dc:description>\n", escape(m.Description))
+	}
+	fmt.Fprintf(&buf, `    <meta property="dcterms:modified">%s</meta>
+    <meta property="rendition:layout">pre-paginated</meta>
+    <meta property="rendition:orientation">portrait</meta>
+    <meta property="rendition:spread">none</meta>
+    <meta name="cover" content="image-1"/>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+`, m.Modified.UTC().Format("2006-01-02T15:04:05Z"))
+	for i, p := range w.pages {
+		properties := ""
+		if i == 0 {
+			properties = ` properties="cover-image"`
+		}
+		fmt.Fprintf(&buf, "    <item id=\"image-%d\" href=\"images/%s\" media-type=\"%s\"%s/>\n", i+1, escape(p.name), p.mediaType, properties)
+		fmt.Fprintf(&buf, "    <item id=\"page-%d\" href=\"%s\" media-type=\"application/xhtml+xml\"/>\n", i+1, pageFile(i))
+	}
+	direction := "ltr"
+	if m.RightToLeft {
+		direction = "rtl"
+	}
+	fmt.Fprintf(&buf, `  </manifest>
+  <spine page-progression-direction="%s">
+`, direction)
+	for i := range w.pages {
+		fmt.Fprintf(&buf, "    <itemref idref=\"page-%d\"/>\n", i+1)
+	}
+	buf.WriteString(`  </spine>
+</package>
+`)
+	return buf.Bytes()
+}
@@ -0,0 +1,100 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriter(t *testing.T) {
+	var img bytes.Buffer
+	jpeg.Encode(&img, image.NewGray(image.Rect(0, 0, 20, 30)), nil)
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, Metadata{
+		Title:       "Naruto & friends",
+		Authors:     []string{"Kishimoto Masashi"},
+		RightToLeft: true,
+		Modified:    time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	/* pages out of order */
+	for _, p := range []struct{ name, chapter string }{
+		{"image-002-000.jpg", "Chapter 2"},
+		{"image-001-000.jpg", "Chapter 1"},
+		{"image-001-001.jpg", "Chapter 1"},
+	} {
+		if err := w.AddPage(p.name, p.chapter, img.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.AddPage("page.html", "Chapter 3", []byte("<html>")); err == nil {
+		t.Error("page without image accepted")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, f := range r.File {
+		rc, _ := f.Open()
+		data, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+	if r.File[0].Name != "mimetype" || r.File[0].Method != zip.Store || files["mimetype"] != "application/epub+zip" {
+		t.Error("mimetype is not the first stored entry")
+	}
+
+	for name, expects := range map[string][]string{
+		"OEBPS/content.opf": {
+			`<dc:identifier id="book-id">` + UUID("Naruto & friends") + `</dc:identifier>`,
+			`<dc:title>Naruto &amp; friends</dc:title>`,
+			`<dc:creator>Kishimoto Masashi</dc:creator>`,
+			`<meta property="dcterms:modified">2020-01-02T03:04:05Z</meta>`,
+			`<meta property="rendition:layout">pre-paginated</meta>`,
+			`<item id="image-1" href="images/image-001-000.jpg" media-type="image/jpeg" properties="cover-image"/>`,
+			`<spine page-progression-direction="rtl">`,
+			`<itemref idref="page-3"/>`},
+		"OEBPS/nav.xhtml": {
+			`<li><a href="pages/page-0001.xhtml">Chapter 1</a></li>`,
+			`<li><a href="pages/page-0003.xhtml">Chapter 2</a></li>`},
+		"OEBPS/pages/page-0002.xhtml": {
+			`<meta name="viewport" content="width=20, height=30"/>`,
+			`<img src="../images/image-001-001.jpg" alt=""/>`},
+	} {
+		for _, expect := range expects {
+			if !strings.Contains(files[name], expect) {
+				t.Errorf("Missing %s in %s:\n%s", expect, name, files[name])
+			}
+		}
+	}
+	if strings.Count(files["OEBPS/nav.xhtml"], "<li>") != 2 {
+		t.Errorf("Expect an entry per chapter:\n%s", files["OEBPS/nav.xhtml"])
+	}
+}
+
+func TestUUID(t *testing.T) {
+	/* a version 5 UUID in the URL namespace */
+	if got := UUID("http://www.example.com"); got != "urn:uuid:2d32a3f1-fac2-52a6-ac52-fe9e87e628ea" {
+		t.Errorf("Got %s", got)
+	}
+}
+
+func TestWriterEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, Metadata{Title: "Naruto"})
+	if err := w.Close(); err == nil {
+		t.Error("book without pages closed")
+	}
+}
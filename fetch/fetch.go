@@ -0,0 +1,314 @@
+package fetch
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultUserAgent is sent when Config has no user agent. Some sites refuse
+// requests without a browser user agent.
+const DefaultUserAgent = "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"
+
+// Config configures a Client
+type Config struct {
+	// Timeout limits a whole request, including reading the body
+	Timeout time.Duration
+	// DialTimeout limits connecting to a host
+	DialTimeout time.Duration
+	// UserAgent defaults to DefaultUserAgent
+	UserAgent string
+	// Headers are sent with every request
+	Headers map[string]string
+	// CookieFile keeps the cookies between runs, if set
+	CookieFile string
+	// Insecure skips the verification of TLS certificates
+	Insecure bool
+	// CAFile is a PEM file of additional trusted certificate authorities
+	CAFile string
+	// Limit is the rate of requests to every host, unless WithLimit sets
+	// another one
+	Limit Limit
+	// Retry is the retry policy of Fetch, DefaultRetryPolicy if zero
+	Retry RetryPolicy
+}
+
+// Client is the HTTP client shared by every download of a run
+type Client struct {
+	http    *http.Client
+	headers http.Header
+	jar     *persistentJar
+	file    string
+	limiter *limiter
+	limit   Limit
+	retry   RetryPolicy
+}
+
+// New returns a Client configured by cfg
+func New(cfg Config) (*Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.Insecure}
+	if cfg.CAFile != "" {
+		pem, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates found", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if cfg.DialTimeout > 0 {
+		transport.DialContext = (&net.Dialer{
+			Timeout:   cfg.DialTimeout,
+			KeepAlive: 30 * time.Second}).DialContext
+		transport.TLSHandshakeTimeout = cfg.DialTimeout
+	}
+
+	jar, err := newPersistentJar(cfg.CookieFile)
+	if err != nil {
+		return nil, err
+	}
+
+	retry := cfg.Retry
+	if retry == (RetryPolicy{}) {
+		retry = DefaultRetryPolicy
+	}
+
+	headers := make(http.Header)
+	headers.Set("User-Agent", DefaultUserAgent)
+	if cfg.UserAgent != "" {
+		headers.Set("User-Agent", cfg.UserAgent)
+	}
+	for name, value := range cfg.Headers {
+		headers.Set(name, value)
+	}
+
+	return &Client{
+		http: &http.Client{
+			Transport: transport,
+			Jar:       jar,
+			Timeout:   cfg.Timeout},
+		headers: headers,
+		jar:     jar,
+		file:    cfg.CookieFile,
+		limiter: newLimiter(),
+		limit:   cfg.Limit,
+		retry:   retry}, nil
+}
+
+// WithHeaders returns a Client sharing the connections and cookies of c,
+// which also sends headers, such as the headers a site needs
+func (c *Client) WithHeaders(headers map[string]string) *Client {
+	merged := c.headers.Clone()
+	for name, value := range headers {
+		merged.Set(name, value)
+	}
+	client := *c
+	client.headers = merged
+	return &client
+}
+
+// WithLimit returns a Client sharing c, which limits its requests to limit
+// instead, such as the limit of a site. A zero limit keeps the limit of c.
+func (c *Client) WithLimit(limit Limit) *Client {
+	client := *c
+	if !limit.IsZero() {
+		client.limit = limit
+	}
+	return &client
+}
+
+// Get sends a GET request for rawURL, cancelled with ctx. The Referer header
+// is set to referer if it is not empty, e.g. to the page of an image. Get
+// waits as long as the rate limit of the host requires.
+func (c *Client) Get(ctx context.Context, rawURL, referer string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, Permanent(err)
+	}
+	if err := c.limiter.wait(ctx, req.URL.Host, c.limit); err != nil {
+		return nil, err
+	}
+	req.Header = c.headers.Clone()
+	if referer != "" {
+		req.Header.Set("Referer", referer)
+	}
+	return c.http.Do(req)
+}
+
+// Fetch gets rawURL and hands a successful response to read, trying again
+// under the retry policy of c when either fails. read returns a Permanent
+// error for a response that is not worth retrying.
+func (c *Client) Fetch(ctx context.Context, rawURL, referer string, read func(*http.Response) error) error {
+	return c.retry.Do(ctx, rawURL, func() error {
+		resp, err := c.Get(ctx, rawURL, referer)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if err := CheckStatus(resp); err != nil {
+			return err
+		}
+		return read(resp)
+	})
+}
+
+// SaveCookies writes the cookies to the cookie file, if there is one
+func (c *Client) SaveCookies() error {
+	if c.file == "" {
+		return nil
+	}
+	return c.jar.save(c.file)
+}
+
+// persistentJar is a cookie jar which records the cookies it is set, as
+// cookiejar.Jar cannot list its cookies with their attributes, so that they
+// can be saved
+type persistentJar struct {
+	*cookiejar.Jar
+
+	mu      sync.Mutex
+	cookies map[string]savedCookie
+}
+
+/* savedCookie is a cookie in the cookie file, with the URL which set it */
+type savedCookie struct {
+	URL      string    `json:"url"`
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Domain   string    `json:"domain,omitempty"`
+	Path     string    `json:"path,omitempty"`
+	Expires  time.Time `json:"expires,omitempty"`
+	Secure   bool      `json:"secure,omitempty"`
+	HTTPOnly bool      `json:"httpOnly,omitempty"`
+}
+
+func newPersistentJar(file string) (*persistentJar, error) {
+	cookies, _ := cookiejar.New(nil)
+	jar := &persistentJar{Jar: cookies, cookies: make(map[string]savedCookie)}
+	if file == "" {
+		return jar, nil
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return jar, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved []savedCookie
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	now := time.Now()
+	for _, cookie := range saved {
+		u, err := url.Parse(cookie.URL)
+		if err != nil || (!cookie.Expires.IsZero() && cookie.Expires.Before(now)) {
+			continue
+		}
+		jar.SetCookies(u, []*http.Cookie{{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Domain:   cookie.Domain,
+			Path:     cookie.Path,
+			Expires:  cookie.Expires,
+			Secure:   cookie.Secure,
+			HttpOnly: cookie.HTTPOnly}})
+	}
+	return jar, nil
+}
+
+func (jar *persistentJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	jar.Jar.SetCookies(u, cookies)
+
+	jar.mu.Lock()
+	defer jar.mu.Unlock()
+	now := time.Now()
+	for _, cookie := range cookies {
+		saved := savedCookie{
+			URL:      u.Scheme + "://" + u.Host + "/",
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Domain:   strings.ToLower(strings.TrimPrefix(cookie.Domain, ".")),
+			Path:     cookie.Path,
+			Expires:  cookie.Expires,
+			Secure:   cookie.Secure,
+			HTTPOnly: cookie.HttpOnly}
+		if saved.Path == "" || saved.Path[0] != '/' {
+			saved.Path = defaultPath(u.Path)
+		}
+		switch {
+		case cookie.MaxAge > 0:
+			saved.Expires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+		case cookie.MaxAge < 0:
+			saved.Expires = time.Unix(1, 0)
+		}
+
+		/* a cookie replaces the one of the same name, domain and path,
+		host-only cookies being scoped by the host which set them */
+		domain := saved.Domain
+		if domain == "" {
+			domain = u.Hostname()
+		}
+		key := domain + ";" + saved.Path + ";" + saved.Name
+		if !saved.Expires.IsZero() && saved.Expires.Before(now) {
+			delete(jar.cookies, key)
+			continue
+		}
+		jar.cookies[key] = saved
+	}
+}
+
+// defaultPath returns the path of a cookie which has none, the directory of
+// the request path
+func defaultPath(path string) string {
+	i := strings.LastIndex(path, "/")
+	if path == "" || path[0] != '/' || i == 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+func (jar *persistentJar) save(file string) error {
+	jar.mu.Lock()
+	defer jar.mu.Unlock()
+
+	/* expired cookies are dropped, in a stable order */
+	now := time.Now()
+	var keys []string
+	for key, cookie := range jar.cookies {
+		if cookie.Expires.IsZero() || cookie.Expires.After(now) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	saved := []savedCookie{}
+	for _, key := range keys {
+		saved = append(saved, jar.cookies[key])
+	}
+	data, err := json.MarshalIndent(saved, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0600)
+}
@@ -0,0 +1,137 @@
+package fetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestHeaders(t *testing.T) {
+	var got http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer ts.Close()
+
+	client, err := New(Config{Headers: map[string]string{"Accept-Language": "en"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = client.WithHeaders(map[string]string{"X-Site": "site"})
+	resp, err := client.Get(context.Background(), ts.URL, "http://example.com/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	expect := map[string]string{
+		"User-Agent":      DefaultUserAgent,
+		"Accept-Language": "en",
+		"X-Site":          "site",
+		"Referer":         "http://example.com/page"}
+	for name, value := range expect {
+		if got.Get(name) != value {
+			t.Errorf("Header %s: got %q, expect %q", name, got.Get(name), value)
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	client, err := New(Config{Timeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get(context.Background(), ts.URL, ""); err == nil {
+		t.Error("Expected a timeout")
+	}
+}
+
+func TestCookies(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("session"); err != nil {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "42", Expires: time.Now().Add(time.Hour)})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	file := filepath.Join(t.TempDir(), "cookies.json")
+	client, err := New(Config{CookieFile: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(context.Background(), ts.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if err := client.SaveCookies(); err != nil {
+		t.Fatal(err)
+	}
+
+	/* a new client sends the saved cookie */
+	client, err = New(Config{CookieFile: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = client.Get(context.Background(), ts.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Cookie not sent after reload, status %s", resp.Status)
+	}
+}
+
+func TestPersistentJar(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cookies.json")
+	jar, _ := newPersistentJar(file)
+	site, _ := url.Parse("http://www.example.com/manga/naruto")
+	jar.SetCookies(site, []*http.Cookie{
+		{Name: "domain", Value: "1", Domain: ".example.com", Path: "/"},
+		{Name: "path", Value: "2", Path: "/manga"},
+		{Name: "expired", Value: "3", Expires: time.Now().Add(time.Hour)},
+		{Name: "secure", Value: "4", Path: "/", Secure: true}})
+	/* the server expires a cookie */
+	jar.SetCookies(site, []*http.Cookie{{Name: "expired", Value: "", MaxAge: -1}})
+	if err := jar.save(file); err != nil {
+		t.Fatal(err)
+	}
+
+	jar, err := newPersistentJar(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		url    string
+		expect []string
+	}{
+		{"http://cdn.example.com/", []string{"domain"}},
+		{"http://www.example.com/", []string{"domain"}},
+		{"http://www.example.com/manga/naruto/1", []string{"domain", "path"}},
+		{"https://www.example.com/", []string{"domain", "secure"}},
+	} {
+		u, _ := url.Parse(c.url)
+		var got []string
+		for _, cookie := range jar.Cookies(u) {
+			got = append(got, cookie.Name)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("%s: got cookies %v, expect %v", c.url, got, c.expect)
+		}
+	}
+}
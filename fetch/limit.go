@@ -0,0 +1,110 @@
+package fetch
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Limit is the rate of requests allowed to a host, as a token bucket of Burst
+// tokens refilled at Rate tokens per second. The zero Limit allows every
+// request at once.
+type Limit struct {
+	// Rate is the number of requests per second, 0 for no limit
+	Rate float64
+	// Burst is the number of requests allowed at once, at least 1
+	Burst int
+	// MinDelay is the least time between two requests
+	MinDelay time.Duration
+	// Jitter is the most random time added before a request
+	Jitter time.Duration
+}
+
+// IsZero reports whether l allows every request at once
+func (l Limit) IsZero() bool {
+	return l == Limit{}
+}
+
+// limiter limits the requests to every host, shared by the copies of a Client
+// so that every worker draws from the same buckets
+type limiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// bucket is the token bucket of a host
+type bucket struct {
+	limit  Limit
+	tokens float64
+	last   time.Time // last refill
+	next   time.Time // earliest next request, for MinDelay
+}
+
+func newLimiter() *limiter {
+	return &limiter{buckets: make(map[string]*bucket)}
+}
+
+// wait blocks until a request to host is allowed, or ctx is done. The
+// bucket of a host is created with the limit of its first request.
+func (l *limiter) wait(ctx context.Context, host string, limit Limit) error {
+	if limit.IsZero() {
+		return nil
+	}
+
+	l.mu.Lock()
+	b, found := l.buckets[host]
+	if !found {
+		b = newBucket(limit)
+		l.buckets[host] = b
+	}
+	delay := b.reserve(time.Now())
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func newBucket(limit Limit) *bucket {
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return &bucket{limit: limit, tokens: float64(limit.Burst)}
+}
+
+// reserve takes a token for a request at now and returns how long the request
+// has to wait. Tokens may go negative, so that waiting requests queue up.
+func (b *bucket) reserve(now time.Time) time.Duration {
+	at := now
+	if b.limit.Rate > 0 {
+		if !b.last.IsZero() {
+			b.tokens += now.Sub(b.last).Seconds() * b.limit.Rate
+			if b.tokens > float64(b.limit.Burst) {
+				b.tokens = float64(b.limit.Burst)
+			}
+		}
+		b.last = now
+		b.tokens--
+		if b.tokens < 0 {
+			at = now.Add(time.Duration(-b.tokens / b.limit.Rate * float64(time.Second)))
+		}
+	}
+
+	if at.Before(b.next) {
+		at = b.next
+	}
+	if b.limit.Jitter > 0 {
+		at = at.Add(time.Duration(rand.Int63n(int64(b.limit.Jitter))))
+	}
+	b.next = at.Add(b.limit.MinDelay)
+	return at.Sub(now)
+}
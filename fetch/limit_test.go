@@ -0,0 +1,75 @@
+package fetch
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBucketReserve(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newBucket(Limit{Rate: 2, Burst: 2})
+
+	/* the burst goes at once, then a request every half second */
+	expect := []time.Duration{0, 0, 500 * time.Millisecond, time.Second}
+	for i, delay := range expect {
+		if got := b.reserve(now); got != delay {
+			t.Errorf("Request %d: got %v, expect %v", i, got, delay)
+		}
+	}
+
+	/* tokens refill with time, up to the burst */
+	b = newBucket(Limit{Rate: 2, Burst: 2})
+	b.reserve(now)
+	b.reserve(now)
+	if got := b.reserve(now.Add(10 * time.Second)); got != 0 {
+		t.Errorf("Got %v after refill, expect 0", got)
+	}
+}
+
+func TestBucketMinDelay(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newBucket(Limit{MinDelay: time.Second})
+	expect := []time.Duration{0, time.Second, 2 * time.Second}
+	for i, delay := range expect {
+		if got := b.reserve(now); got != delay {
+			t.Errorf("Request %d: got %v, expect %v", i, got, delay)
+		}
+	}
+
+	b = newBucket(Limit{MinDelay: time.Second, Jitter: time.Second})
+	for i := 0; i < 3; i++ {
+		if got := b.reserve(now); got < time.Duration(i)*time.Second || got >= time.Duration(2*i+1)*time.Second {
+			t.Errorf("Request %d: got %v out of the jitter", i, got)
+		}
+	}
+}
+
+func TestLimiterShared(t *testing.T) {
+	client, err := New(Config{Limit: Limit{MinDelay: time.Hour}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/* the first request to a host passes, the next waits even from another copy */
+	if err := client.limiter.wait(context.Background(), "example.com", client.limit); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	other := client.WithHeaders(nil)
+	if err := other.limiter.wait(ctx, "example.com", other.limit); err == nil {
+		t.Error("Second request not delayed")
+	}
+
+	/* other hosts have their own bucket, and a site limit replaces the global one */
+	if err := client.limiter.wait(context.Background(), "example.org", client.limit); err != nil {
+		t.Error(err)
+	}
+	if got := client.WithLimit(Limit{Rate: 1}).limit; got != (Limit{Rate: 1}) {
+		t.Errorf("Got limit %v, expect the site limit", got)
+	}
+	if got := client.WithLimit(Limit{}).limit; got != client.limit {
+		t.Errorf("Got limit %v, expect the global limit", got)
+	}
+}
@@ -0,0 +1,171 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy decides how often and when a failed request is tried again.
+// The delay before a retry doubles from Base up to Max, plus a random part of
+// up to Jitter times the delay. A Retry-After header of a 429 or 503 response
+// is honored instead when it asks for longer.
+type RetryPolicy struct {
+	// Attempts is the number of tries of a request, including the first
+	Attempts int
+	// Base is the delay before the first retry
+	Base time.Duration
+	// Max is the longest delay between two tries
+	Max time.Duration
+	// Jitter is the random fraction of a delay added to it, between 0 and 1
+	Jitter float64
+}
+
+// DefaultRetryPolicy is used by a Client configured without a retry policy
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts: 3,
+	Base:     time.Second,
+	Max:      30 * time.Second,
+	Jitter:   0.2}
+
+// StatusError is the error of a response with an unexpected status code
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+	// RetryAfter is the delay asked for by the Retry-After header, if any
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("error getting %s: %s", e.URL, e.Status)
+}
+
+// permanentError is an error that retrying does not fix
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// CheckStatus returns a *StatusError unless resp is successful
+func CheckStatus(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	return &StatusError{
+		URL:        resp.Request.URL.String(),
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		RetryAfter: retryAfter(resp.Header.Get("Retry-After"), time.Now())}
+}
+
+// retryAfter parses a Retry-After header, either seconds or a date
+func retryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// Retryable reports whether a request failing with err may succeed when
+// tried again. Client errors (4xx) are permanent, except for 408 Request
+// Timeout and 429 Too Many Requests, and so is a cancelled context.
+func Retryable(err error) bool {
+	var permanent permanentError
+	var status *StatusError
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, context.Canceled):
+		return false
+	case errors.As(err, &permanent):
+		return false
+	case errors.As(err, &status):
+		switch status.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests:
+			return true
+		}
+		return status.StatusCode < 400 || status.StatusCode >= 500
+	}
+	return true
+}
+
+// Delay returns how long to wait before retrying after the attempt-th try
+// (from 0) failed with err
+func (p RetryPolicy) Delay(attempt int, err error) time.Duration {
+	delay := p.Base
+	for i := 0; i < attempt && delay < p.Max; i++ {
+		delay *= 2
+	}
+	if p.Max > 0 && delay > p.Max {
+		delay = p.Max
+	}
+	if p.Jitter > 0 && delay > 0 {
+		delay += time.Duration(rand.Float64() * p.Jitter * float64(delay))
+	}
+
+	var status *StatusError
+	if errors.As(err, &status) && status.RetryAfter > delay {
+		switch status.StatusCode {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			delay = status.RetryAfter
+		}
+	}
+	return delay
+}
+
+// Do calls try until it succeeds, fails with an error that is not
+// Retryable, or the attempts run out. The last error is returned.
+func (p RetryPolicy) Do(ctx context.Context, name string, try func() error) error {
+	attempts := p.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			delay := p.Delay(attempt-1, err)
+			log.Println("Error getting", name, err, "retrying in", delay.Round(time.Millisecond), "...", attempt)
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
+		}
+
+		err = try()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !Retryable(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("%w, after %d tries", err, attempts)
+}
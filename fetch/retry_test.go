@@ -0,0 +1,136 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryable(t *testing.T) {
+	cases := []struct {
+		err    error
+		expect bool
+	}{
+		{nil, false},
+		{errors.New("connection reset"), true},
+		{context.Canceled, false},
+		{Permanent(errors.New("no image")), false},
+		{&StatusError{StatusCode: http.StatusNotFound}, false},
+		{&StatusError{StatusCode: http.StatusForbidden}, false},
+		{&StatusError{StatusCode: http.StatusRequestTimeout}, true},
+		{&StatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{&StatusError{StatusCode: http.StatusBadGateway}, true},
+		{&StatusError{StatusCode: http.StatusServiceUnavailable}, true},
+	}
+	for _, c := range cases {
+		if got := Retryable(c.err); got != c.expect {
+			t.Errorf("%v: got %v, expect %v", c.err, got, c.expect)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	p := RetryPolicy{Base: time.Second, Max: 5 * time.Second}
+	expect := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for attempt, delay := range expect {
+		if got := p.Delay(attempt, errors.New("error")); got != delay {
+			t.Errorf("Attempt %d: got %v, expect %v", attempt, got, delay)
+		}
+	}
+
+	/* Retry-After is honored on 429 and 503 only */
+	busy := &StatusError{StatusCode: http.StatusServiceUnavailable, RetryAfter: time.Minute}
+	if got := p.Delay(0, busy); got != time.Minute {
+		t.Errorf("Got %v, expect the Retry-After delay", got)
+	}
+	broken := &StatusError{StatusCode: http.StatusInternalServerError, RetryAfter: time.Minute}
+	if got := p.Delay(0, broken); got != time.Second {
+		t.Errorf("Got %v, expect the backoff delay", got)
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 10; i++ {
+		if got := p.Delay(1, errors.New("error")); got < 2*time.Second || got >= 3*time.Second {
+			t.Errorf("Got %v out of the jitter", got)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := map[string]time.Duration{
+		"":                              0,
+		"120":                           2 * time.Minute,
+		"-1":                            0,
+		"Wed, 01 Jan 2020 00:00:30 GMT": 30 * time.Second,
+		"Tue, 31 Dec 2019 00:00:00 GMT": 0,
+		"soon":                          0,
+	}
+	for header, expect := range cases {
+		if got := retryAfter(header, now); got != expect {
+			t.Errorf("%q: got %v, expect %v", header, got, expect)
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch {
+		case r.URL.Path == "/missing":
+			http.NotFound(w, r)
+		case r.URL.Path == "/busy" || requests == 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte("page"))
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New(Config{Retry: RetryPolicy{Attempts: 3, Base: time.Millisecond}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/* a 503 is retried */
+	var body []byte
+	err = client.Fetch(context.Background(), ts.URL, "", func(resp *http.Response) error {
+		body, err = ioutil.ReadAll(resp.Body)
+		return err
+	})
+	if err != nil || string(body) != "page" || requests != 2 {
+		t.Errorf("Got %q, %v after %d requests, expect page after 2", body, err, requests)
+	}
+
+	/* a 404 is not */
+	requests = 0
+	err = client.Fetch(context.Background(), ts.URL+"/missing", "", func(resp *http.Response) error { return nil })
+	var status *StatusError
+	if !errors.As(err, &status) || status.StatusCode != http.StatusNotFound || requests != 1 {
+		t.Errorf("Got %v after %d requests, expect 404 after 1", err, requests)
+	}
+
+	/* nor a permanent error of read, while others are retried until the attempts run out */
+	requests = 1
+	client.Fetch(context.Background(), ts.URL, "", func(resp *http.Response) error { return Permanent(errors.New("bad page")) })
+	if requests != 2 {
+		t.Errorf("Permanent error retried, %d requests", requests-1)
+	}
+	requests = 1
+	err = client.Fetch(context.Background(), ts.URL, "", func(resp *http.Response) error { return errors.New("bad page") })
+	if err == nil || requests != 4 {
+		t.Errorf("Got %v after %d requests, expect an error after 3", err, requests-1)
+	}
+
+	/* the last error is kept once the attempts run out */
+	err = client.Fetch(context.Background(), ts.URL+"/busy", "", func(resp *http.Response) error { return nil })
+	if !errors.As(err, &status) || status.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Got %v, expect a 503 after 3 tries", err)
+	}
+}
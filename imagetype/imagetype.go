@@ -0,0 +1,179 @@
+package imagetype
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/webp"
+)
+
+// Type is an image format pages may be in
+type Type struct {
+	Name string
+	// Ext is the extension of archive entries in this format
+	Ext  string
+	MIME string
+}
+
+// The image types of pages
+var (
+	JPEG = Type{Name: "jpeg", Ext: ".jpg", MIME: "image/jpeg"}
+	PNG  = Type{Name: "png", Ext: ".png", MIME: "image/png"}
+	GIF  = Type{Name: "gif", Ext: ".gif", MIME: "image/gif"}
+	WebP = Type{Name: "webp", Ext: ".webp", MIME: "image/webp"}
+	AVIF = Type{Name: "avif", Ext: ".avif", MIME: "image/avif"}
+)
+
+// ErrUnknown is returned for data which is not in a known image type, such as
+// an html error page
+var ErrUnknown = errors.New("unknown image type")
+
+var configDecoders = map[Type]func([]byte) (image.Config, error){
+	JPEG: func(data []byte) (image.Config, error) { return jpeg.DecodeConfig(bytes.NewReader(data)) },
+	PNG:  func(data []byte) (image.Config, error) { return png.DecodeConfig(bytes.NewReader(data)) },
+	GIF:  func(data []byte) (image.Config, error) { return gif.DecodeConfig(bytes.NewReader(data)) },
+	WebP: func(data []byte) (image.Config, error) { return webp.DecodeConfig(bytes.NewReader(data)) },
+}
+
+var decoders = map[Type]func([]byte) (image.Image, error){
+	JPEG: func(data []byte) (image.Image, error) { return jpeg.Decode(bytes.NewReader(data)) },
+	PNG:  func(data []byte) (image.Image, error) { return png.Decode(bytes.NewReader(data)) },
+	GIF:  func(data []byte) (image.Image, error) { return gif.Decode(bytes.NewReader(data)) },
+	WebP: func(data []byte) (image.Image, error) { return webp.Decode(bytes.NewReader(data)) },
+}
+
+// Sniff returns the type of an image from its signature
+func Sniff(data []byte) (Type, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return JPEG, nil
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return PNG, nil
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return GIF, nil
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return WebP, nil
+	case isAVIF(data):
+		return AVIF, nil
+	}
+	return Type{}, ErrUnknown
+}
+
+// Ext returns the extension of an image from its signature, ".jpg" when it
+// is unknown
+func Ext(data []byte) string {
+	t, err := Sniff(data)
+	if err != nil {
+		return JPEG.Ext
+	}
+	return t.Ext
+}
+
+// Validate returns the type of an image, after checking that it is complete
+// by decoding it. There is no AVIF decoder, an AVIF image is only checked to
+// be a complete sequence of boxes.
+func Validate(data []byte) (Type, error) {
+	t, err := Sniff(data)
+	if err != nil {
+		return t, err
+	}
+	if t == AVIF {
+		return t, checkBoxes(data)
+	}
+	if _, err := decoders[t](data); err != nil {
+		return t, fmt.Errorf("incomplete %s: %v", t.Name, err)
+	}
+	return t, nil
+}
+
+// Decode decodes an image of any type but AVIF
+func Decode(data []byte) (image.Image, Type, error) {
+	t, err := Sniff(data)
+	if err != nil {
+		return nil, t, err
+	}
+	decode, found := decoders[t]
+	if !found {
+		return nil, t, fmt.Errorf("cannot decode %s images", t.Name)
+	}
+	img, err := decode(data)
+	return img, t, err
+}
+
+// Size returns the width and height of an image from its header, without
+// decoding it. The size of AVIF images is not known.
+func Size(data []byte) (int, int, error) {
+	t, err := Sniff(data)
+	if err != nil {
+		return 0, 0, err
+	}
+	decodeConfig, found := configDecoders[t]
+	if !found {
+		return 0, 0, fmt.Errorf("unknown size of %s images", t.Name)
+	}
+	config, err := decodeConfig(data)
+	return config.Width, config.Height, err
+}
+
+// isAVIF reports whether data starts with an ISO BMFF "ftyp" box with an AVIF
+// brand, as major or compatible brand
+func isAVIF(data []byte) bool {
+	if len(data) < 16 || string(data[4:8]) != "ftyp" {
+		return false
+	}
+	size := int(binary.BigEndian.Uint32(data))
+	if size < 16 || size > len(data) {
+		return false
+	}
+	/* major brand, minor version, then compatible brands */
+	brands := [][]byte{data[8:12]}
+	for i := 16; i+4 <= size; i += 4 {
+		brands = append(brands, data[i:i+4])
+	}
+	for _, brand := range brands {
+		if string(brand) == "avif" || string(brand) == "avis" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkBoxes checks that data is a sequence of ISO BMFF boxes ending at the
+// end of data, with a media data box
+func checkBoxes(data []byte) error {
+	hasMedia := false
+	for offset := 0; offset < len(data); {
+		if len(data)-offset < 8 {
+			return errors.New("incomplete avif: truncated box header")
+		}
+		size := uint64(binary.BigEndian.Uint32(data[offset:]))
+		header := uint64(8)
+		switch size {
+		case 0: // the box extends to the end of data
+			size = uint64(len(data) - offset)
+		case 1: // 64 bit size
+			if len(data)-offset < 16 {
+				return errors.New("incomplete avif: truncated box header")
+			}
+			size = binary.BigEndian.Uint64(data[offset+8:])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)-offset) {
+			return errors.New("incomplete avif: truncated box")
+		}
+		if string(data[offset+4:offset+8]) == "mdat" {
+			hasMedia = true
+		}
+		offset += int(size)
+	}
+	if !hasMedia {
+		return errors.New("incomplete avif: no media data")
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package imagetype
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+/* a 1x1 lossless webp */
+var webpImage, _ = base64.StdEncoding.DecodeString("UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA==")
+
+/* an ftyp box with the avif brand, then a media data box */
+var avifImage = []byte("\x00\x00\x00\x14ftypavif\x00\x00\x00\x00mif1\x00\x00\x00\x0cmdat\x01\x02\x03\x04")
+
+func encode(t *testing.T, encoder func(*bytes.Buffer, image.Image) error) []byte {
+	var buf bytes.Buffer
+	if err := encoder(&buf, image.NewRGBA(image.Rect(0, 0, 10, 10))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestValidate(t *testing.T) {
+	images := map[Type][]byte{
+		JPEG: encode(t, func(buf *bytes.Buffer, img image.Image) error { return jpeg.Encode(buf, img, nil) }),
+		PNG:  encode(t, func(buf *bytes.Buffer, img image.Image) error { return png.Encode(buf, img) }),
+		GIF:  encode(t, func(buf *bytes.Buffer, img image.Image) error { return gif.Encode(buf, img, nil) }),
+		WebP: webpImage,
+		AVIF: avifImage,
+	}
+	for expect, data := range images {
+		got, err := Validate(data)
+		if err != nil || got != expect {
+			t.Errorf("%s: got %s, %v", expect.Name, got.Name, err)
+		}
+		if ext := Ext(data); ext != expect.Ext {
+			t.Errorf("%s: got extension %s", expect.Name, ext)
+		}
+
+		if expect != AVIF {
+			if w, h, err := Size(data); err != nil || w*h == 0 {
+				t.Errorf("%s: got size %dx%d, %v", expect.Name, w, h, err)
+			}
+		}
+
+		/* a truncated image is detected */
+		if _, err := Validate(data[:len(data)-3]); err == nil {
+			t.Errorf("%s: truncated image accepted", expect.Name)
+		}
+	}
+
+	if _, err := Validate([]byte("<html>Not found</html>")); err != ErrUnknown {
+		t.Errorf("Got %v for html, expect %v", err, ErrUnknown)
+	}
+	if got := Ext(nil); got != ".jpg" {
+		t.Errorf("Got extension %s for unknown data, expect .jpg", got)
+	}
+}
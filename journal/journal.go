@@ -0,0 +1,197 @@
+package journal
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mangadl/chapter"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Journal keeps the pages downloaded so far in a directory, with a log of
+// the completed pages and chapters and their hashes, so that an interrupted
+// download can be resumed without downloading them again.
+//
+// A nil *Journal is valid and records nothing.
+type Journal struct {
+	dir string
+
+	mu       sync.Mutex
+	log      *os.File
+	pages    map[pageKey]string
+	chapters map[chapter.ID]int
+}
+
+type pageKey struct {
+	chapter chapter.ID
+	page    int
+}
+
+/* record is a line of the journal log, either a page or a completed chapter */
+type record struct {
+	Chapter chapter.ID `json:"chapter"`
+	Page    int        `json:"page"`
+	SHA256  string     `json:"sha256,omitempty"`
+	Pages   int        `json:"pages,omitempty"`
+}
+
+const logName = "journal.jsonl"
+
+// Open opens the journal in dir. With resume, the pages and chapters
+// recorded by a previous download are kept, otherwise the journal is reset.
+func Open(dir string, resume bool) (*Journal, error) {
+	if !resume {
+		if err := os.RemoveAll(dir); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	j := &Journal{
+		dir:      dir,
+		pages:    make(map[pageKey]string),
+		chapters: make(map[chapter.ID]int)}
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+
+	logFile, err := os.OpenFile(filepath.Join(dir, logName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	j.log = logFile
+	return j, nil
+}
+
+/* load reads the records of a previous download */
+func (j *Journal) load() error {
+	f, err := os.Open(filepath.Join(j.dir, logName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			/* the last line is incomplete if the download was killed while writing it */
+			continue
+		}
+		if r.Pages > 0 {
+			j.chapters[r.Chapter] = r.Pages
+		} else {
+			j.pages[pageKey{r.Chapter, r.Page}] = r.SHA256
+		}
+	}
+	return scanner.Err()
+}
+
+func (j *Journal) pagePath(c chapter.ID, page int) string {
+	return filepath.Join(j.dir, fmt.Sprintf("%s-%03d.page", c.Pad(3), page))
+}
+
+func (j *Journal) append(r record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = j.log.Write(append(line, '\n'))
+	return err
+}
+
+// Page returns a page of a previous download, if it is complete and intact
+func (j *Journal) Page(c chapter.ID, page int) ([]byte, bool) {
+	if j == nil {
+		return nil, false
+	}
+	j.mu.Lock()
+	hash, found := j.pages[pageKey{c, page}]
+	j.mu.Unlock()
+	if !found {
+		return nil, false
+	}
+
+	data, err := ioutil.ReadFile(j.pagePath(c, page))
+	if err != nil || hashOf(data) != hash {
+		return nil, false
+	}
+	return data, true
+}
+
+// SavePage records a downloaded page
+func (j *Journal) SavePage(c chapter.ID, page int, data []byte) error {
+	if j == nil {
+		return nil
+	}
+
+	/* write the page before recording it, so that a recorded page is complete */
+	path := j.pagePath(c, page)
+	if err := ioutil.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+
+	hash := hashOf(data)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.pages[pageKey{c, page}] = hash
+	return j.append(record{Chapter: c, Page: page, SHA256: hash})
+}
+
+// Chapter returns the number of pages of a chapter completed by a previous
+// download
+func (j *Journal) Chapter(c chapter.ID) (int, bool) {
+	if j == nil {
+		return 0, false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	pages, found := j.chapters[c]
+	return pages, found
+}
+
+// ChapterDone records that all pages of a chapter are downloaded
+func (j *Journal) ChapterDone(c chapter.ID, pages int) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.chapters[c] = pages
+	return j.append(record{Chapter: c, Pages: pages})
+}
+
+// Close closes the journal, keeping it for a later resume
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	return j.log.Close()
+}
+
+// Remove closes and deletes the journal, once the download is complete
+func (j *Journal) Remove() error {
+	if j == nil {
+		return nil
+	}
+	j.log.Close()
+	return os.RemoveAll(j.dir)
+}
+
+func hashOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,85 @@
+package journal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "manga.journal")
+
+	j, err := Open(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.SavePage("1", 0, []byte("page 1-0"))
+	j.SavePage("1", 1, []byte("page 1-1"))
+	j.ChapterDone("1", 2)
+	j.SavePage("10.5", 3, []byte("page 10.5-3"))
+	j.SavePage("10.5", 4, []byte("page 10.5-4"))
+	j.Close()
+
+	/* a page corrupted after being recorded, and a truncated log */
+	ioutil.WriteFile(j.pagePath("10.5", 4), []byte("page 10.5-"), 0644)
+	f, _ := os.OpenFile(filepath.Join(dir, logName), os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"chapter":"2","pa`)
+	f.Close()
+
+	/* resume */
+	j, err = Open(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages, found := j.Chapter("1"); !found || pages != 2 {
+		t.Errorf("Chapter 1: got %d %v", pages, found)
+	}
+	if _, found := j.Chapter("10.5"); found {
+		t.Error("incomplete chapter 10.5 found")
+	}
+	if data, found := j.Page("10.5", 3); !found || !reflect.DeepEqual(data, []byte("page 10.5-3")) {
+		t.Errorf("Page 10.5-3: got %q %v", data, found)
+	}
+	if _, found := j.Page("10.5", 4); found {
+		t.Error("corrupted page 10.5-4 found")
+	}
+
+	/* the journal keeps records made after resuming */
+	j.SavePage("10.5", 4, []byte("page 10.5-4"))
+	j.Close()
+	j, _ = Open(dir, true)
+	if _, found := j.Page("10.5", 4); !found {
+		t.Error("page 10.5-4 saved after resume not found")
+	}
+	j.Close()
+
+	/* without resume the journal starts over */
+	j, _ = Open(dir, false)
+	if _, found := j.Chapter("1"); found {
+		t.Error("chapter 1 found in a new journal")
+	}
+	if err := j.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("journal not removed")
+	}
+}
+
+func TestNilJournal(t *testing.T) {
+	var j *Journal
+	if err := j.SavePage("1", 0, []byte("page")); err != nil {
+		t.Error(err)
+	}
+	if _, found := j.Page("1", 0); found {
+		t.Error("page found in nil journal")
+	}
+	if err := j.ChapterDone("1", 1); err != nil {
+		t.Error(err)
+	}
+	if _, found := j.Chapter("1"); found {
+		t.Error("chapter found in nil journal")
+	}
+}
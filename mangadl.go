@@ -1,392 +1,1106 @@
 package main
 
 import (
-	"archive/zip"
-	"bytes"
+	"context"
+	"flag"
 	"fmt"
-	"image/jpeg"
 	"io"
 	"io/ioutil"
 	"log"
+	"mangadl/chapter"
 	"mangadl/combine"
+	"mangadl/comicinfo"
+	"mangadl/fetch"
+	"mangadl/imagetype"
+	"mangadl/journal"
+	"mangadl/process"
+	"mangadl/site"
+	_ "mangadl/sites/comicextra"
+	_ "mangadl/sites/mangafox"
+	_ "mangadl/sites/mangareader"
 	"net/http"
 	"os"
-	"strconv"
+	"os/signal"
+	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 )
 
-// Site definition ...
-type Site struct {
-	url         string
-	img         func(*goquery.Document) string
-	pageList    func(string, int, *goquery.Document) []string
-	page        func(string) string
-	chapter     func(int) string
-	parChapters int
-	parPages    int
-}
-
-var comicextra = Site{
-	url: "http://www.comicextra.com/",
-	img: func(doc *goquery.Document) string {
-		imageURL, found := doc.Find("#main_img").Attr("src")
-		if !found {
-			log.Fatal("image not found in page: ", doc.Url.String())
-		}
-		return imageURL
-	},
-	pageList: func(manga string, chapter int, doc *goquery.Document) []string {
-		var links []string
-		doc.Find("select[name=page_select]").Find("option").Each(func(i int, s *goquery.Selection) {
-			if link, found := s.Attr("value"); found == true {
-				links = append(links, link)
-			}
-		})
-		return links
-	},
-	page:        func(n string) string { return fmt.Sprintf("/%s", n) },
-	chapter:     func(n int) string { return fmt.Sprintf("/chapter-%d", n) },
-	parChapters: 1,
-	parPages:    5}
-
-var mangareader = Site{
-	url: "http://www.mangareader.net/",
-	img: func(doc *goquery.Document) string {
-		imageURL, found := doc.Find("#img").Attr("src")
-		if !found {
-			log.Fatal("image not found: ", doc.Url.String())
-		}
-		return imageURL
-	},
-	pageList: func(manga string, chapter int, doc *goquery.Document) []string {
-		var links []string
-		doc.Find("#pageMenu").First().Find("option").Each(func(i int, s *goquery.Selection) {
-			if link, found := s.Attr("value"); found == true {
-				formattedLink := fmt.Sprintf("http://www.mangareader.net%s", link)
-				links = append(links, formattedLink)
-			}
-		})
-		return links
-	},
-	page:        func(n string) string { return fmt.Sprintf("/%s", n) },
-	chapter:     func(n int) string { return fmt.Sprintf("/%d", n) },
-	parChapters: 6,
-	parPages:    6}
-
-var mangafox = Site{
-	url: "http://mangafox.me/manga/",
-	img: func(doc *goquery.Document) string {
-		imageURL, found := doc.Find("#image").Attr("src")
-		if !found {
-			fmt.Println(doc.Html())
-			log.Fatal("image not found: ", doc.Url.String())
-		}
-		return imageURL
-	},
-	pageList: func(manga string, chapter int, doc *goquery.Document) []string {
-		var links []string
-		doc.Find("select.m").First().Find("option").Each(func(i int, s *goquery.Selection) {
-			if link, found := s.Attr("value"); found == true {
-				formattedLink := fmt.Sprintf("http://mangafox.me/manga/%s/c%03d/%s.html", manga, chapter, link)
-				if link != "0" {
-					links = append(links, formattedLink)
-				}
-			}
-		})
-		return links
-	},
-	page:        func(n string) string { return fmt.Sprintf("/%s.html", n) },
-	chapter:     func(n int) string { return fmt.Sprintf("/c%03d", n) },
-	parChapters: 1,
-	parPages:    1}
-
-var sites = map[string]Site{
-	"mangareader": mangareader,
-	"mangafox":    mangafox,
-	"comicextra":  comicextra}
-
 // DownloadJob ...
 type DownloadJob struct {
-	Chapter int
+	Chapter chapter.ID
 	Page    int
 	Link    string
 }
 
 // DownloadResult ...
 type DownloadResult struct {
+	Chapter chapter.ID
 	Name    string
 	Content []byte
+	Err     error
 }
 
-func downloadImage(url string) []byte {
-	for retry := 1; retry <= 3; retry++ {
-		/* open url */
-		response, errHTTP := http.Get(url)
-		if errHTTP != nil {
-			log.Println("Error getting", url, "retrying...", retry)
-			time.Sleep(3 * time.Second)
-			continue
-		}
-		defer response.Body.Close()
+// ChapterResult is the outcome of downloading a chapter
+type ChapterResult struct {
+	Chapter chapter.ID
+	Err     error
+}
 
-		/* download image data ([]byte) from url */
-		data, err := ioutil.ReadAll(response.Body)
-		if err != nil {
-			log.Fatalf("ioutil.ReadAll -> %v", err)
-		}
+// What to do with a chapter that failed to download
+const (
+	onErrorSkip  = "skip"
+	onErrorRetry = "retry"
+	onErrorAbort = "abort"
+)
 
-		/* check if downloaded data is a valid jpeg */
-		_, errJpeg := jpeg.Decode(bytes.NewReader(data))
-		if errJpeg != nil {
-			log.Println("Error getting", url, "(incomplete file) retrying...", retry)
-			log.Println("Header", response.Header.Get("Location"))
-			time.Sleep(3 * time.Second)
-			continue
-		}
+// Exit status of a download
+const (
+	exitSkipped   = 2   // some chapters failed and are missing from the archives
+	exitAborted   = 3   // the download was aborted, the archives only have the chapters done before
+	exitCancelled = 130 // the download was interrupted, as a shell reports SIGINT
+)
 
-		return data
-	}
-	log.Println("Error downloading image after 3 retries:", url)
-	return nil
+// DownloadError is returned by downloadChapters when chapters failed or the
+// download was cancelled
+type DownloadError struct {
+	Failed    []chapter.ID
+	Cancelled []chapter.ID
+	Aborted   bool
 }
 
-func createCBZ(cbzName string, downloadedPages <-chan DownloadResult, wgFile *sync.WaitGroup) {
-	/* create the cbz file */
-	file, createErr := os.Create(cbzName)
-	if createErr != nil {
-		log.Fatal(createErr)
+func (e *DownloadError) Error() string {
+	switch {
+	case len(e.Cancelled) > 0:
+		return fmt.Sprintf("download cancelled, failed chapters: %v, cancelled chapters: %v", e.Failed, e.Cancelled)
+	case e.Aborted:
+		return fmt.Sprintf("download aborted, failed chapters: %v", e.Failed)
 	}
-	log.Println("Creating cbz:", cbzName)
+	return fmt.Sprintf("failed chapters: %v", e.Failed)
+}
 
-	/* write to buffer from result channel */
-	var wgCBZ sync.WaitGroup
-	wgCBZ.Add(1)
-	go cbzChan(file, downloadedPages, &wgCBZ)
-	wgCBZ.Wait()
+// downloadImage downloads the image at url, with the page it is on as referer
+func downloadImage(ctx context.Context, client *fetch.Client, url, referer string) ([]byte, error) {
+	var data []byte
+	err := client.Fetch(ctx, url, referer, func(response *http.Response) error {
+		/* download image data ([]byte) from url */
+		var err error
+		if data, err = ioutil.ReadAll(response.Body); err != nil {
+			return err
+		}
 
-	/* close the cbz file */
-	if closeErr := file.Close(); closeErr != nil {
-		log.Fatal(closeErr)
+		/* check if downloaded data is a complete image */
+		_, err = imagetype.Validate(data)
+		return err
+	})
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
 	}
-	log.Printf("%s closed\n", cbzName)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading image %s: %w", url, err)
+	}
+	return data, nil
+}
 
-	/* signal to downloadChapters that all writes are done and the file is closed */
-	wgFile.Done()
+// Metadata is what is known of a series, for the ComicInfo of its archives.
+// Series is nil when the site has no chapter list, and Volumes when the
+// chapters are not split by volume.
+type Metadata struct {
+	Manga   string
+	Info    site.Info
+	URL     string
+	Series  *site.Series
+	Volumes map[chapter.ID]string
 }
 
-func cbzChan(writer io.Writer, downloadedPages <-chan DownloadResult, wgCBZ *sync.WaitGroup) {
-	/* create the zip archive from buffer */
-	zipWriter := zip.NewWriter(writer)
+// ComicInfo returns the metadata of an archive of chapters, without its pages
+func (m *Metadata) ComicInfo(chapters []chapter.ID) *comicinfo.ComicInfo {
+	info := &comicinfo.ComicInfo{
+		Series:      m.Manga,
+		Web:         m.URL,
+		LanguageISO: m.Info.Language}
+	if m.Info.RightToLeft {
+		info.Manga = comicinfo.MangaRightToLeft
+	}
 
-	/* write to archive as each finished page arrives in channel */
-	for file := range downloadedPages {
-		/* create zip writer with header of filename, DEFLATE method, and current time */
-		header := zip.FileHeader{
-			Name:   file.Name,
-			Method: zip.Deflate}
-		header.SetModTime(time.Now())
-		f, err := zipWriter.CreateHeader(&header)
-		if err != nil {
-			log.Fatal(err)
+	/* chapters of the archive in the chapter list */
+	listed := make(map[chapter.ID]site.Chapter)
+	if m.Series != nil {
+		if m.Series.Title != "" {
+			info.Series = m.Series.Title
 		}
+		info.Writer = comicinfo.List(m.Series.Authors)
+		info.Genre = comicinfo.List(m.Series.Genres)
+		info.Summary = m.Series.Summary
+		for _, c := range m.Series.Chapters {
+			listed[c.ID] = c
+		}
+	}
 
-		/* write content to zip archive */
-		_, err = f.Write(file.Content)
-		if err != nil {
-			log.Fatal(err)
+	switch len(chapters) {
+	case 0:
+	case 1:
+		info.Number = string(chapters[0])
+		info.Title = listed[chapters[0]].Title
+		if url := listed[chapters[0]].URL; url != "" {
+			info.Web = url
 		}
+	default:
+		info.Title = fmt.Sprintf("Chapters %s-%s", chapters[0], chapters[len(chapters)-1])
 	}
 
-	/* close the archive */
-	err := zipWriter.Close()
-	if err != nil {
-		log.Fatal(err)
+	/* the volume of the archive, if all its chapters are in the same one */
+	volumes := make(map[string]bool)
+	for _, c := range chapters {
+		volume, found := m.Volumes[c]
+		if !found {
+			volume = listed[c].Volume
+		}
+		volumes[volume] = true
+	}
+	if len(volumes) == 1 {
+		for volume := range volumes {
+			info.Volume = volume
+		}
 	}
+	return info
+}
 
-	/* signal to createCBZ that all writes are done and the archive is closed */
-	wgCBZ.Done()
+// ChapterTitle returns the title of a chapter in a table of contents, with
+// its title in the chapter list if there is one
+func (m *Metadata) ChapterTitle(c chapter.ID) string {
+	if m.Series != nil {
+		for _, listed := range m.Series.Chapters {
+			if listed.ID == c && listed.Title != "" {
+				return fmt.Sprintf("Chapter %s: %s", c, listed.Title)
+			}
+		}
+	}
+	return fmt.Sprintf("Chapter %s", c)
+}
 
+// Released returns the latest release date of chapters in the chapter list,
+// or the epoch of archives when none is known
+func (m *Metadata) Released(chapters []chapter.ID) time.Time {
+	var released time.Time
+	if m != nil && m.Series != nil {
+		for _, listed := range m.Series.Chapters {
+			for _, c := range chapters {
+				if listed.ID == c && listed.Date.After(released) {
+					released = listed.Date
+				}
+			}
+		}
+	}
+	if released.IsZero() {
+		return epoch
+	}
+	return released
 }
 
-func getFirstPage(site, manga string, chapter int) ([]string, []byte) {
-	/* get first page html */
-	url := sites[site].url + manga + sites[site].chapter(chapter) + sites[site].page("1")
+// BookTitle returns the title of a book of chapters, e.g. "Naruto Chapter 1:
+// Uzumaki Naruto" or "Naruto Chapters 1-5"
+func (m *Metadata) BookTitle(chapters []chapter.ID) string {
+	info := m.ComicInfo(chapters)
+	if len(chapters) == 1 {
+		return strings.TrimSpace(info.Series + " " + m.ChapterTitle(chapters[0]))
+	}
+	return strings.TrimSpace(info.Series + " " + info.Title)
+}
 
-	resp, errget := http.Get(url)
-	if errget != nil {
-		log.Fatal("Error getting first page ", url)
+// getDocument downloads and parses the html page at url
+func getDocument(ctx context.Context, client *fetch.Client, url string) (*goquery.Document, error) {
+	var doc *goquery.Document
+	err := client.Fetch(ctx, url, "", func(resp *http.Response) error {
+		var err error
+		doc, err = goquery.NewDocumentFromResponse(resp)
+		return err
+	})
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
 	}
-	defer resp.Body.Close()
+	return doc, err
+}
 
-	doc, err := goquery.NewDocumentFromResponse(resp)
+func getFirstPage(ctx context.Context, client *fetch.Client, s site.Site, manga string, chapter chapter.ID, j *journal.Journal) ([]string, []byte, error) {
+	/* get first page html */
+	url := s.ChapterURL(manga, chapter)
+
+	doc, err := getDocument(ctx, client, url)
 	if err != nil {
-		log.Println(doc.Html())
-		log.Fatal(err)
+		return nil, nil, fmt.Errorf("error getting first page: %w", err)
 	}
 
-	/* get first page image */
-	pageImageURL := sites[site].img(doc)
-	pageImageBytes := downloadImage(pageImageURL)
+	/* get first page image, unless a previous download has it */
+	pageImageBytes, found := j.Page(chapter, 0)
+	if !found {
+		pageImageURL, err := s.Image(doc)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", url, err)
+		}
+		pageImageBytes, err = downloadImage(ctx, client, pageImageURL, url)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := j.SavePage(chapter, 0, pageImageBytes); err != nil {
+			return nil, nil, err
+		}
+	}
 
 	/* get all pages links */
-	links := sites[site].pageList(manga, chapter, doc)
+	links := s.PageList(manga, chapter, doc)
 
-	return links, pageImageBytes
+	return links, pageImageBytes, nil
 }
 
-func downloadPage(n int, site string, jobs <-chan DownloadJob, downloadedPages chan<- DownloadResult, wgPages *sync.WaitGroup) {
+func downloadPage(ctx context.Context, n int, client *fetch.Client, s site.Site, j *journal.Journal, jobs <-chan DownloadJob, downloadedPages chan<- DownloadResult, wgPages *sync.WaitGroup) {
 	for job := range jobs {
-		/* download page html -- job.Link */
-		resp, errget := http.Get(job.Link)
-		if errget != nil {
-			log.Fatal("Error getting ", job.Link)
-		}
-		defer resp.Body.Close()
+		result := DownloadResult{Chapter: job.Chapter}
 
-		doc, err := goquery.NewDocumentFromResponse(resp)
-		if err != nil {
-			log.Fatal(err)
+		/* download the page, unless a previous download has it */
+		var found bool
+		result.Content, found = j.Page(job.Chapter, job.Page)
+		if !found {
+			if result.Err = ctx.Err(); result.Err == nil {
+				result.Content, result.Err = getPage(ctx, client, s, job.Link)
+			}
+			if result.Err == nil {
+				result.Err = j.SavePage(job.Chapter, job.Page, result.Content)
+			}
+		}
+		result.Name = pageName(job.Chapter, job.Page, result.Content)
+		if result.Err != nil {
+			result.Err = fmt.Errorf("chapter %s, page %d: %w", job.Chapter, job.Page, result.Err)
+		} else {
+			log.Printf("Chapter %s, Page %d done", job.Chapter, job.Page)
 		}
-
-		/* get image url */
-		imageURL := sites[site].img(doc)
-
-		/* download jpg */
-		imageBytes := downloadImage(imageURL)
 
 		/* send downloaded page to result channel */
-		log.Printf("Chapter %d, Page %d done", job.Chapter, job.Page)
-		downloadedPages <- DownloadResult{fmt.Sprintf("image-%03d-%03d.jpg", job.Chapter, job.Page), imageBytes}
+		downloadedPages <- result
 
 		/* signal to downloadChapter that this page is done */
 		wgPages.Done()
 	}
 }
 
-func downloadChapter(site, manga string, chapters <-chan int, downloadedPages chan<- DownloadResult, numWorkers int, wgChapter *sync.WaitGroup) {
-	for chapter := range chapters {
-		/* get the first page & page links of the chapter */
-		links, pageImageBytes := getFirstPage(site, manga, chapter)
-
-		/* send the first page to the results channel */
-		firstPageName := fmt.Sprintf("image-%03d-000.jpg", chapter)
-		firstPageContent := pageImageBytes
-		firstPage := DownloadResult{firstPageName, firstPageContent}
-		downloadedPages <- firstPage
-
-		/** pages job producer **/
-		/* channel for pages to download */
-		jobs := make(chan DownloadJob)
-		/* send jobs to worker channel, and close the channel */
-		go func() {
-			/* starting from the 2nd page onwards */
-			for i := 1; i < len(links); i++ {
-				jobs <- DownloadJob{chapter, i, links[i]}
-			}
-			close(jobs)
-		}()
+// getPage downloads the image of the page at link
+func getPage(ctx context.Context, client *fetch.Client, s site.Site, link string) ([]byte, error) {
+	/* download page html */
+	doc, err := getDocument(ctx, client, link)
+	if err != nil {
+		return nil, err
+	}
+
+	/* get image url */
+	imageURL, err := s.Image(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", link, err)
+	}
+
+	/* download jpg */
+	return downloadImage(ctx, client, imageURL, link)
+}
+
+// journalChapter returns the pages of a chapter completed by a previous
+// download, if they are all intact
+func journalChapter(j *journal.Journal, chapter chapter.ID) ([]DownloadResult, bool) {
+	numPages, found := j.Chapter(chapter)
+	if !found {
+		return nil, false
+	}
+	var pages []DownloadResult
+	for i := 0; i < numPages; i++ {
+		content, found := j.Page(chapter, i)
+		if !found {
+			return nil, false
+		}
+		pages = append(pages, DownloadResult{Chapter: chapter, Name: pageName(chapter, i, content), Content: content})
+	}
+	return pages, true
+}
+
+// getChapter downloads every page of a chapter, sorted by name
+func getChapter(ctx context.Context, client *fetch.Client, s site.Site, manga string, chapter chapter.ID, j *journal.Journal, numWorkers int) ([]DownloadResult, error) {
+	/* reuse a chapter completed by a previous download */
+	if pages, found := journalChapter(j, chapter); found {
+		log.Println("Chapter", chapter, "resumed")
+		return pages, nil
+	}
+
+	/* get the first page & page links of the chapter */
+	links, pageImageBytes, err := getFirstPage(ctx, client, s, manga, chapter, j)
+	if err != nil {
+		return nil, err
+	}
+	pages := []DownloadResult{{Chapter: chapter, Name: pageName(chapter, 0, pageImageBytes), Content: pageImageBytes}}
+
+	/** pages job producer **/
+	/* channel for pages to download */
+	jobs := make(chan DownloadJob)
+	/* send jobs to worker channel, and close the channel */
+	go func() {
+		/* starting from the 2nd page onwards */
+		for i := 1; i < len(links); i++ {
+			jobs <- DownloadJob{chapter, i, links[i]}
+		}
+		close(jobs)
+	}()
+
+	/** pages workers **/
+	numPages := len(links) - 1 // first page is already done
+	if numPages < 0 {
+		numPages = 0
+	}
+	/* channel for downloaded pages, large enough for the whole chapter */
+	results := make(chan DownloadResult, numPages)
+	/* create pages waitgroup */
+	var wgPages sync.WaitGroup
+	wgPages.Add(numPages)
+	/* create workers */
+	for i := 1; i <= numWorkers; i++ {
+		go downloadPage(ctx, i, client, s, j, jobs, results, &wgPages)
+	}
+
+	/* wait until all pages are downloaded */
+	wgPages.Wait()
+	close(results)
 
-		/** pages workers **/
-		/* create pages waitgroup */
-		var wgPages sync.WaitGroup
-		wgPages.Add(len(links) - 1) // first page is already done
-		/* create workers */
-		for i := 1; i <= numWorkers; i++ {
-			go downloadPage(i, site, jobs, downloadedPages, &wgPages)
+	for page := range results {
+		if page.Err != nil && err == nil {
+			err = page.Err
 		}
+		pages = append(pages, page)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-		/* wait until all pages are downloaded */
-		wgPages.Wait()
+	sort.Slice(pages, func(a, b int) bool {
+		return pages[a].Name < pages[b].Name
+	})
+	if err := j.ChapterDone(chapter, len(pages)); err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// processChapter runs the pages of a chapter through the pipeline, naming
+// them again as the pipeline may change their number and type
+func processChapter(pipeline *process.Pipeline, chapter chapter.ID, pages []DownloadResult) ([]DownloadResult, error) {
+	if pipeline == nil {
+		return pages, nil
+	}
+	var contents [][]byte
+	for _, page := range pages {
+		contents = append(contents, page.Content)
+	}
+	contents, err := pipeline.Process(contents)
+	if err != nil {
+		/* the same pages fail the same way on every try */
+		return nil, fetch.Permanent(fmt.Errorf("chapter %s: %w", chapter, err))
+	}
+	processed := make([]DownloadResult, len(contents))
+	for i, content := range contents {
+		processed[i] = DownloadResult{Chapter: chapter, Name: pageName(chapter, i, content), Content: content}
+	}
+	return processed, nil
+}
+
+func downloadChapter(ctx context.Context, client *fetch.Client, s site.Site, manga string, j *journal.Journal, pipeline *process.Pipeline, chapters <-chan chapter.ID, downloadedPages chan<- DownloadResult, chapterResults chan<- ChapterResult, numWorkers int) {
+	for chapter := range chapters {
+		/* download the whole chapter before writing it, so that a failed
+		chapter does not leave some of its pages in the archive */
+		pages, err := getChapter(ctx, client, s, manga, chapter, j, numWorkers)
+		if err == nil {
+			pages, err = processChapter(pipeline, chapter, pages)
+		}
+		if err == nil {
+			for _, page := range pages {
+				downloadedPages <- page
+			}
+			log.Println("Chapter", chapter, "done")
+		}
 
 		/* signal to downloadChapters that this chapter is done */
-		log.Println("Chapter", chapter, "done")
-		wgChapter.Done()
+		chapterResults <- ChapterResult{chapter, err}
 	}
 }
 
-func downloadChapters(site, manga string, fromChapter, toChapter, numChapterWorkers, numPageWorkers int) {
+// downloadOptions are how downloadChapters handles the chapters besides
+// downloading them
+type downloadOptions struct {
+	Output Output
+	// Journal records the downloaded pages, nil for none
+	Journal *journal.Journal
+	// Pipeline processes the pages of every chapter, nil to keep them
+	Pipeline *process.Pipeline
+	// Metadata is written with the chapters, nil for none
+	Metadata *Metadata
+	// OnError is onErrorSkip, onErrorAbort or onErrorRetry
+	OnError string
+	// Retries is how many times a failed chapter is retried with onErrorRetry
+	Retries int
+}
+
+func downloadChapters(ctx context.Context, client *fetch.Client, s site.Site, manga string, chapters []chapter.ID, archiveName func(chapter.ID) string, options downloadOptions, numChapterWorkers, numPageWorkers int) error {
 	/* get number of chapters from command line */
-	numChapters := toChapter - fromChapter + 1 // +1 to include the starting chapter
+	numChapters := len(chapters)
 	log.Println("Number of chapters:", numChapters)
 
 	/* channel for chapters to be downloaded */
-	chaptersJob := make(chan int)
+	chaptersJob := make(chan chapter.ID)
 
 	/* channel for downloaded pages */
 	downloadedPages := make(chan DownloadResult)
 
-	/* create waitgroup for chapter download work */
-	var wgChapter sync.WaitGroup
-	wgChapter.Add(numChapters)
+	/* channel for the outcome of every chapter */
+	chapterResults := make(chan ChapterResult)
 
 	/* make workers */
 	for i := 1; i <= numChapterWorkers; i++ {
-		go downloadChapter(site, manga, chaptersJob, downloadedPages, numPageWorkers, &wgChapter)
+		go downloadChapter(ctx, client, s, manga, options.Journal, options.Pipeline, chaptersJob, downloadedPages, chapterResults, numPageWorkers)
 	}
 
-	/* send jobs to worker channel, and close the channel */
+	/* send downloaded pages to the archive writer, and finished chapters
+	to complete their archives when split */
+	var finished chan chapter.ID
+	cbzErr := make(chan error, 1)
+	if archiveName != nil {
+		finished = make(chan chapter.ID)
+	}
 	go func() {
-		for i := fromChapter; i <= toChapter; i++ {
-			chaptersJob <- i
+		if archiveName != nil {
+			cbzErr <- splitArchives(func(c chapter.ID) string {
+				return outputName(archiveName(c), options.Output.Format)
+			}, options.Output.open, downloadedPages, chapters, finished, options.Metadata)
+		} else {
+			cbzErr <- createArchive(outputName(cbzName(manga, chapters), options.Output.Format), options.Output.open, downloadedPages, options.Metadata)
 		}
-		close(chaptersJob)
 	}()
 
-	/* send downloaded pages to cbz writer */
-	var wgCBZ sync.WaitGroup
-	wgCBZ.Add(1)
-	var cbzFile string
-	if fromChapter == toChapter {
-		cbzFile = fmt.Sprintf("%s-%03d.cbz", manga, fromChapter)
-	} else {
-		cbzFile = fmt.Sprintf("%s-%03d-%03d.cbz", manga, fromChapter, toChapter)
-	}
-	cbzFile = strings.Replace(cbzFile, "/", "_", -1)
-	go createCBZ(cbzFile, downloadedPages, &wgCBZ)
+	/* send jobs to workers, and decide what to do with failed chapters */
+	pending := append([]chapter.ID(nil), chapters...)
+	tries := make(map[chapter.ID]int)
+	running := 0
+	downloadErr := &DownloadError{}
+	for len(pending) > 0 || running > 0 {
+		/* only send a job, or wait for cancellation, when there is one */
+		var jobs chan<- chapter.ID
+		var cancelled <-chan struct{}
+		var next chapter.ID
+		if len(pending) > 0 {
+			jobs = chaptersJob
+			cancelled = ctx.Done()
+			next = pending[0]
+		}
 
-	/* wait for all chapter downloads */
-	wgChapter.Wait()
+		select {
+		case jobs <- next:
+			pending = pending[1:]
+			tries[next]++
+			running++
 
-	/* close the results channel, signaling createCBZchan process to clean up & terminate */
+		case <-cancelled:
+			log.Println("Cancelled, waiting for the chapters in progress")
+			downloadErr.Cancelled = append(downloadErr.Cancelled, pending...)
+			pending = nil
+
+		case result := <-chapterResults:
+			running--
+			if result.Err == nil {
+				finish(finished, result.Chapter)
+				continue
+			}
+			if ctx.Err() != nil {
+				/* interrupted chapters are not failures, and are not retried */
+				downloadErr.Cancelled = append(downloadErr.Cancelled, result.Chapter)
+				finish(finished, result.Chapter)
+				continue
+			}
+			log.Printf("Chapter %s failed: %v", result.Chapter, result.Err)
+
+			switch {
+			case options.OnError == onErrorRetry && tries[result.Chapter] <= options.Retries && fetch.Retryable(result.Err):
+				log.Println("Retrying chapter", result.Chapter)
+				pending = append(pending, result.Chapter)
+			case options.OnError == onErrorAbort:
+				log.Println("Aborting, waiting for the chapters in progress")
+				downloadErr.Aborted = true
+				pending = nil
+				downloadErr.Failed = append(downloadErr.Failed, result.Chapter)
+				finish(finished, result.Chapter)
+			default:
+				log.Println("Skipping chapter", result.Chapter)
+				downloadErr.Failed = append(downloadErr.Failed, result.Chapter)
+				finish(finished, result.Chapter)
+			}
+		}
+	}
+	close(chaptersJob)
+
+	/* close the results channel, signaling the cbz writer to clean up & terminate */
 	close(downloadedPages)
+	if finished != nil {
+		close(finished)
+	}
 
 	log.Println("All chapters done")
 
-	/* wait until createCBZchan finished cleanly */
-	wgCBZ.Wait()
+	/* wait until the cbz writer finished cleanly */
+	if err := <-cbzErr; err != nil {
+		return err
+	}
+	if len(downloadErr.Failed) > 0 || len(downloadErr.Cancelled) > 0 {
+		chapter.Sort(downloadErr.Failed)
+		chapter.Sort(downloadErr.Cancelled)
+		return downloadErr
+	}
+	return nil
+}
+
+// finish tells the archive writer that a chapter is finished, when it
+// listens
+func finish(finished chan<- chapter.ID, c chapter.ID) {
+	if finished != nil {
+		finished <- c
+	}
+}
+
+// pageName returns the archive entry name of a page, with the extension of
+// its image type. Padding the chapter keeps the entries of all chapters in
+// reading order when sorted by name.
+func pageName(c chapter.ID, page int, content []byte) string {
+	return fmt.Sprintf("image-%s-%03d%s", c.Pad(3), page, imagetype.Ext(content))
+}
+
+// cbzName returns the name of the archive of chapters, named after the
+// first and last chapters
+func cbzName(manga string, chapters []chapter.ID) string {
+	first, last := chapters[0], chapters[len(chapters)-1]
+	var name string
+	if first == last {
+		name = fmt.Sprintf("%s-%s.cbz", manga, first.Pad(3))
+	} else {
+		name = fmt.Sprintf("%s-%s-%s.cbz", manga, first.Pad(3), last.Pad(3))
+	}
+	return strings.Replace(name, "/", "_", -1)
+}
+
+// journalName returns the name of the journal of a download, named after the
+// chapter range expression rather than the chapters it resolves to, which
+// change with new releases between a download and its resume
+func journalName(manga, expr string) string {
+	name := fmt.Sprintf("%s-%s.journal", manga, strings.Replace(expr, " ", "", -1))
+	return strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+}
+
+// volumeCBZName returns the name of the archive of a volume
+func volumeCBZName(manga, volume string) string {
+	name := fmt.Sprintf("%s-v%s.cbz", manga, chapter.ID(volume).Pad(2))
+	return strings.Replace(name, "/", "_", -1)
+}
+
+// archiveNames returns the name of the archive of each chapter for split mode
+// chapter or volume, or nil for a single archive of all chapters. Chapters
+// without a volume are written to an archive of their own.
+func archiveNames(split, manga string, chapters []chapter.ID, volumes map[chapter.ID]string) func(chapter.ID) string {
+	switch split {
+	case "chapter":
+		return func(c chapter.ID) string {
+			return cbzName(manga, []chapter.ID{c})
+		}
+
+	case "volume":
+		var unassigned []chapter.ID
+		for _, c := range chapters {
+			if volumes[c] == "" {
+				unassigned = append(unassigned, c)
+			}
+		}
+		if len(unassigned) > 0 {
+			log.Println("Chapters without a volume:", unassigned)
+		}
+		return func(c chapter.ID) string {
+			if volume := volumes[c]; volume != "" {
+				return volumeCBZName(manga, volume)
+			}
+			return cbzName(manga, unassigned)
+		}
+	}
+	return nil
+}
+
+// chapterVolumes returns the volume of each chapter, from the chapter to
+// volume mapping file if given, or else from the chapter list of the series,
+// nil when the site has none
+func chapterVolumes(series *site.Series, manga, file string, chapters []chapter.ID) (map[chapter.ID]string, error) {
+	volumes := make(map[chapter.ID]string)
+
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		mapping, err := chapter.ParseVolumes(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		for _, c := range chapters {
+			if volume, found := mapping.Volume(c); found {
+				volumes[c] = volume
+			}
+		}
+		return volumes, nil
+	}
+
+	if series == nil {
+		return nil, fmt.Errorf("cannot get volumes without a chapter list, use a volume mapping file")
+	}
+	for _, c := range series.Chapters {
+		if c.Volume != "" {
+			volumes[c.ID] = c.Volume
+		}
+	}
+	if len(volumes) == 0 {
+		return nil, fmt.Errorf("no volumes found for %s, use a volume mapping file", manga)
+	}
+	return volumes, nil
+}
+
+func getSeries(ctx context.Context, client *fetch.Client, s site.Site, manga string) (*site.Series, error) {
+	indexer, ok := s.(site.Indexer)
+	if !ok {
+		return nil, fmt.Errorf("site %s cannot list chapters", s.Info().URL)
+	}
+
+	/* get the series landing page html */
+	doc, err := getDocument(ctx, client, indexer.SeriesURL(manga))
+	if err != nil {
+		return nil, err
+	}
+
+	return indexer.Index(manga, doc)
+}
+
+func printChapters(w io.Writer, series *site.Series) {
+	if series.Title != "" {
+		fmt.Fprintln(w, series.Title)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, c := range series.Chapters {
+		date := ""
+		if !c.Date.IsZero() {
+			date = c.Date.Format("2006-01-02")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", c.ID, date, c.Title, c.URL)
+	}
+	tw.Flush()
+}
+
+// chapterRange returns the chapters to download from a chapter range
+// expression on the command line, see chapter.Range. The chapter list of the
+// series is used to resolve the range when the site has one, and returned,
+// or else nil.
+func chapterRange(ctx context.Context, client *fetch.Client, s site.Site, manga string, expr string) ([]chapter.ID, *site.Series, error) {
+	r, err := chapter.ParseRange(expr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	/* only fail without a chapter list if the range cannot be resolved without it */
+	var available []chapter.ID
+	var series *site.Series
+	if _, ok := s.(site.Indexer); ok || r.NeedsIndex() {
+		series, err = getSeries(ctx, client, s, manga)
+		switch {
+		case err == nil:
+			for _, c := range series.Chapters {
+				available = append(available, c.ID)
+			}
+		case r.NeedsIndex():
+			return nil, nil, err
+		default:
+			log.Println("Cannot get the chapter list, downloading chapters as given:", err)
+		}
+	}
+
+	chapters, err := r.Resolve(available)
+	return chapters, series, err
+}
+
+// pipelineOptions are the command line options of the page pipeline
+type pipelineOptions struct {
+	Format              string
+	Quality             int
+	MaxWidth, MaxHeight int
+	Profile             string
+	Dither              bool
+	Spreads             string
+	Trim                bool
+	TrimTolerance       int
+	TrimMin             float64
+	Webtoon             bool
+	SliceHeight         int
+}
+
+// newPipeline returns the page pipeline of the command line options, nil
+// when pages are kept as downloaded
+func newPipeline(options pipelineOptions) (*process.Pipeline, error) {
+	format, err := process.ParseFormat(options.Format)
+	if err != nil {
+		return nil, err
+	}
+	if options.Quality < 0 || options.Quality > 100 {
+		return nil, fmt.Errorf("quality %d is not between 1 and 100", options.Quality)
+	}
+	if options.MaxWidth < 0 || options.MaxHeight < 0 {
+		return nil, fmt.Errorf("negative maximum size %dx%d", options.MaxWidth, options.MaxHeight)
+	}
+
+	spreads, err := process.ParseOrder(options.Spreads)
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline := &process.Pipeline{Output: process.Output{Format: format, Quality: options.Quality}}
+	if options.Webtoon {
+		if options.SliceHeight < 0 {
+			return nil, fmt.Errorf("negative slice height %d", options.SliceHeight)
+		}
+		pipeline.Stages = append(pipeline.Stages, process.Webtoon(options.SliceHeight, process.GutterTolerance))
+	}
+	if spreads != "" {
+		pipeline.Stages = append(pipeline.Stages, process.SplitSpreads(spreads))
+	}
+	if options.Trim {
+		if options.TrimTolerance < 0 || options.TrimTolerance > 255 {
+			return nil, fmt.Errorf("trim tolerance %d is not between 0 and 255", options.TrimTolerance)
+		}
+		if options.TrimMin < 0 || options.TrimMin > 1 {
+			return nil, fmt.Errorf("trim minimum %g is not between 0 and 1", options.TrimMin)
+		}
+		pipeline.Stages = append(pipeline.Stages, process.Trim(uint8(options.TrimTolerance), options.TrimMin))
+	}
+	if options.MaxWidth > 0 || options.MaxHeight > 0 {
+		pipeline.Stages = append(pipeline.Stages, process.MaxSize(options.MaxWidth, options.MaxHeight))
+	}
+	if options.Profile != "" {
+		profile, err := process.LookupProfile(options.Profile)
+		if err != nil {
+			return nil, err
+		}
+		profile.Dither = options.Dither
+		pipeline.Stages = append(pipeline.Stages, profile.Stages()...)
+
+		/* dithered pages blur as JPEG, and gray PNG pages are small */
+		if format == "" {
+			pipeline.Output.Format = "png"
+		}
+	}
+	if pipeline.Output == (process.Output{}) && len(pipeline.Stages) == 0 {
+		return nil, nil
+	}
+	return pipeline, nil
+}
+
+// profileNames returns the sorted names of the e-ink profiles
+func profileNames() []string {
+	var names []string
+	for name := range process.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// siteClient returns client with the headers and rate limit of the site
+func siteClient(client *fetch.Client, s site.Site) *fetch.Client {
+	return client.WithHeaders(s.Info().Headers).WithLimit(s.Info().Limit)
+}
+
+// saveCookies keeps the cookies of the sites for the next run
+func saveCookies(client *fetch.Client) {
+	if err := client.SaveCookies(); err != nil {
+		log.Println("Cannot save the cookies:", err)
+	}
+}
+
+// headerFlags are the -header flags, "Name: value" each
+type headerFlags map[string]string
+
+func (h headerFlags) String() string {
+	var headers []string
+	for name, value := range h {
+		headers = append(headers, name+": "+value)
+	}
+	sort.Strings(headers)
+	return strings.Join(headers, ", ")
+}
+
+func (h headerFlags) Set(header string) error {
+	parts := strings.SplitN(header, ":", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return fmt.Errorf("header %q is not Name: value", header)
+	}
+	h[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	return nil
+}
+
+func lookupSite(name string) site.Site {
+	s, found := site.Lookup(name)
+	if !found {
+		log.Fatalf("Unknown site %s, available sites: %s", name, strings.Join(site.Names(), ", "))
+	}
+	return s
+}
+
+// sitesDir returns the directory of site definitions loaded at startup
+func sitesDir() string {
+	if dir := os.Getenv("MANGADL_SITES"); dir != "" {
+		return dir
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "sites"
+	}
+	return filepath.Join(configDir, "mangadl", "sites")
 }
 
 func main() {
 	startTime := time.Now()
 
-	args := os.Args[1:]
+	split := flag.String("split", "none", "archives to write: none for a single archive, chapter for one per chapter, volume for one per volume")
+	onError := flag.String("on-error", onErrorRetry, "what to do with a chapter that fails to download: retry, skip or abort")
+	retries := flag.Int("retries", 2, "number of times to retry a failed chapter with -on-error retry, before skipping it; chapters failing for good, e.g. missing, are skipped at once")
+	resume := flag.Bool("resume", false, "resume an interrupted download, reusing the pages it completed")
+	output := flag.String("output", outputCBZ, "format of the archives: cbz, cbt, epub for fixed layout EPUB 3 books, pdf, or dir for a directory per chapter in a directory of the series")
+	deterministic := flag.Bool("deterministic", false, "write the same cbz or cbt archive for the same pages, sorted, uncompressed and dated by the release of their chapters")
+	volumesFile := flag.String("volumes", "", "chapter to volume mapping file for -split volume, with lines of <volume>: <chapters>")
+	timeout := flag.Duration("timeout", time.Minute, "time limit of a single request, 0 for none")
+	dialTimeout := flag.Duration("dial-timeout", 10*time.Second, "time limit to connect to a site")
+	userAgent := flag.String("user-agent", fetch.DefaultUserAgent, "User-Agent header of the requests")
+	headers := make(headerFlags)
+	flag.Var(headers, "header", "extra `Name: value` header of the requests, may be repeated")
+	cookies := flag.String("cookies", "", "file keeping the cookies between runs")
+	insecure := flag.Bool("insecure", false, "do not verify TLS certificates")
+	caFile := flag.String("ca-cert", "", "PEM file of additional certificate authorities to trust")
+	attempts := flag.Int("attempts", fetch.DefaultRetryPolicy.Attempts, "tries of a request before it fails")
+	backoff := flag.Duration("backoff", fetch.DefaultRetryPolicy.Base, "delay before retrying a request, doubled on every retry")
+	maxBackoff := flag.Duration("max-backoff", fetch.DefaultRetryPolicy.Max, "longest delay before retrying a request, unless the site asks for longer")
+	format := flag.String("format", "", "convert pages to jpeg or png, instead of keeping their format")
+	quality := flag.Int("quality", 0, fmt.Sprintf("re-encode JPEG pages at this quality from 1 to 100, %d when converting", process.DefaultQuality))
+	maxWidth := flag.Int("max-width", 0, "scale pages down to this width, 0 for any width")
+	maxHeight := flag.Int("max-height", 0, "scale pages down to this height, 0 for any height")
+	profile := flag.String("profile", "", "prepare pages for an e-ink device: "+strings.Join(profileNames(), ", "))
+	spreads := flag.String("spreads", "", "split double-page spreads into two pages, the right one first with rtl as in manga, the left one first with ltr")
+	webtoon := flag.Bool("webtoon", false, "stitch the pages of long strip chapters and slice them again at the gutters between panels")
+	sliceHeight := flag.Int("slice-height", 1600, "with -webtoon, most height of a page, 0 for a single tall page per chapter")
+	trim := flag.Bool("trim", false, "crop the uniform margins of scans off pages")
+	trimTolerance := flag.Int("trim-tolerance", 24, "with -trim, gray difference from 0 to 255 still taken for margin")
+	trimMin := flag.Float64("trim-min", 0.5, "with -trim, least part of the width and height of a page to keep, from 0 to 1")
+	dither := flag.Bool("dither", true, "with -profile, dither pages to the gray levels of the device instead of rounding them")
+	rate := flag.Float64("rate", 0, "requests per second to a host, 0 for no limit, for sites without their own limit")
+	burst := flag.Int("burst", 1, "requests to a host allowed at once with -rate")
+	minDelay := flag.Duration("min-delay", 0, "least time between two requests to a host")
+	jitter := flag.Duration("jitter", 0, "most random time added before a request")
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 {
+		log.Fatal("Need <site> <name> <chapters>, chapters <site> <name> or combine <output> <inputs...> parameters")
+	}
+	if *split != "none" && *split != "chapter" && *split != "volume" {
+		log.Fatalf("Unknown split %q, need none, chapter or volume", *split)
+	}
+	found := false
+	for _, format := range formats {
+		found = found || *output == format
+	}
+	if !found {
+		log.Fatalf("Unknown output %q, need one of %s", *output, strings.Join(formats, ", "))
+	}
+	if *output == outputDir && *split != "none" {
+		log.Fatal("-split does not apply to -output dir, which has a directory per chapter")
+	}
+	if *deterministic && *output != outputCBZ && *output != outputCBT {
+		log.Fatal("-deterministic only applies to -output cbz and cbt")
+	}
+	if *onError != onErrorSkip && *onError != onErrorRetry && *onError != onErrorAbort {
+		log.Fatalf("Unknown on-error %q, need retry, skip or abort", *onError)
+	}
+
+	pipeline, err := newPipeline(pipelineOptions{
+		Format:        *format,
+		Quality:       *quality,
+		MaxWidth:      *maxWidth,
+		MaxHeight:     *maxHeight,
+		Profile:       *profile,
+		Dither:        *dither,
+		Spreads:       *spreads,
+		Trim:          *trim,
+		TrimTolerance: *trimTolerance,
+		TrimMin:       *trimMin,
+		Webtoon:       *webtoon,
+		SliceHeight:   *sliceHeight})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	/* cancel the download on SIGINT or SIGTERM, finishing the archives with the
+	chapters done so far, and stop on a second signal */
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	/* one client for every request, so that connections and cookies are shared */
+	client, err := fetch.New(fetch.Config{
+		Timeout:     *timeout,
+		DialTimeout: *dialTimeout,
+		UserAgent:   *userAgent,
+		Headers:     headers,
+		CookieFile:  *cookies,
+		Insecure:    *insecure,
+		CAFile:      *caFile,
+		Limit: fetch.Limit{
+			Rate:     *rate,
+			Burst:    *burst,
+			MinDelay: *minDelay,
+			Jitter:   *jitter},
+		Retry: fetch.RetryPolicy{
+			Attempts: *attempts,
+			Base:     *backoff,
+			Max:      *maxBackoff,
+			Jitter:   fetch.DefaultRetryPolicy.Jitter}})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	/* load site definitions, possibly replacing built-in sites */
+	if err := site.LoadDir(sitesDir()); err != nil {
+		log.Fatal(err)
+	}
 
 	switch args[0] {
 
 	case "combine":
-		combine.Combine()
+		if len(args) < 3 {
+			log.Fatal("Need combine <output> <inputs...> parameters")
+		}
+		combine.Combine(args[1:])
+
+	case "chapters":
+		if len(args) < 3 {
+			log.Fatal("Need chapters <site> <name> parameters")
+		}
+
+		s := lookupSite(args[1])
+		series, err := getSeries(ctx, siteClient(client, s), s, args[2])
+		saveCookies(client)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printChapters(os.Stdout, series)
 
 	default:
 		if len(args) < 3 {
-			log.Fatal("Need <site> <name> <from> <to> parameters")
+			log.Fatal("Need <site> <name> <chapters> parameters, e.g. 1-5,8,10.5,12- or latest-5")
 		}
 
-		site := args[0]
+		s := lookupSite(args[0])
 		manga := args[1]
-		from, _ := strconv.Atoi(args[2])
-		to, _ := strconv.Atoi(args[3])
 
-		parChapters := sites[site].parChapters
-		parPages := sites[site].parPages
+		/* <from> <to> is the range from-to */
+		if len(args) > 4 {
+			log.Fatal("Too many parameters, chapters are given as a single range such as 1-5,8")
+		}
+		expr := strings.Join(args[2:], "-")
+
+		client = siteClient(client, s)
+		chapters, series, err := chapterRange(ctx, client, s, manga, expr)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		parChapters := s.Info().ParChapters
+		parPages := s.Info().ParPages
 
 		log.Println("Parallel chapters:", parChapters, ", parallel pages:", parPages)
-		log.Println(manga, from, to)
+		log.Println(manga, chapters)
 
-		downloadChapters(site, manga, from, to, parChapters, parPages)
+		var volumes map[chapter.ID]string
+		if *split == "volume" {
+			volumes, err = chapterVolumes(series, manga, *volumesFile, chapters)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		/* every archive gets a ComicInfo.xml of what is known of the series */
+		metadata := &Metadata{
+			Manga:   manga,
+			Info:    s.Info(),
+			URL:     s.Info().URL,
+			Series:  series,
+			Volumes: volumes}
+		if indexer, ok := s.(site.Indexer); ok {
+			metadata.URL = indexer.SeriesURL(manga)
+		}
+
+		/* keep the downloaded pages next to the output until the download is complete */
+		j, err := journal.Open(journalName(manga, expr), *resume)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		names := archiveNames(*split, manga, chapters, volumes)
+		if *output == outputDir {
+			/* a single directory of the series, with a directory per chapter */
+			names = func(chapter.ID) string {
+				return strings.Replace(manga, "/", "_", -1)
+			}
+		}
+
+		err = downloadChapters(ctx, client, s, manga, chapters, names, downloadOptions{
+			Output:   Output{Format: *output, Deterministic: *deterministic},
+			Journal:  j,
+			Pipeline: pipeline,
+			Metadata: metadata,
+			OnError:  *onError,
+			Retries:  *retries}, parChapters, parPages)
+		saveCookies(client)
+		if err == nil {
+			if removeErr := j.Remove(); removeErr != nil {
+				log.Println("Cannot remove the journal:", removeErr)
+			}
+		} else {
+			j.Close()
+			log.Println("Downloaded pages are kept, run again with -resume to download the rest")
+		}
+		log.Println("Elapsed time:", time.Since(startTime))
+		if downloadErr, ok := err.(*DownloadError); ok {
+			log.Println(downloadErr)
+			switch {
+			case len(downloadErr.Cancelled) > 0:
+				os.Exit(exitCancelled)
+			case downloadErr.Aborted:
+				os.Exit(exitAborted)
+			}
+			os.Exit(exitSkipped)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
 	log.Println("Elapsed time:", time.Since(startTime))
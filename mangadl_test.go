@@ -3,12 +3,19 @@ package main
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"fmt"
 	"image"
 	"image/jpeg"
 	"io/ioutil"
+	"mangadl/chapter"
+	"mangadl/fetch"
+	"mangadl/journal"
+	"mangadl/process"
+	"mangadl/site"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"sync"
@@ -39,6 +46,9 @@ var imageRGBA = image.NewRGBA(image.Rect(0, 0, 10, 10))
 var imageBuffer = new(bytes.Buffer)
 var imageJPG = jpeg.Encode(imageBuffer, imageRGBA, nil)
 
+/* testClient is a client with the default configuration */
+var testClient, _ = fetch.New(fetch.Config{})
+
 var tsImage = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, imageBuffer)
 }))
@@ -47,25 +57,69 @@ var tsPage = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *
 	fmt.Fprintf(w, pageHTML, tsImage.URL)
 }))
 
-var mockmanga = Site{
-	url: tsPage.URL + "/",
-	img: func(doc *goquery.Document) string {
-		imageURL, _ := doc.Find("#image").Attr("src")
-		return imageURL
-	},
-	pageList: func(manga string, chapter int, doc *goquery.Document) []string {
-		var links []string
-		doc.Find("select#pageList").First().Find("option").Each(func(i int, s *goquery.Selection) {
-			link, _ := s.Attr("value")
-			formattedLink := fmt.Sprintf("%s://%s%s", doc.Url.Scheme, doc.Url.Host, link)
-			links = append(links, formattedLink)
-		})
-		return links
-	},
-	page:        func(n string) string { return fmt.Sprintf("/%s", n) },
-	chapter:     func(n int) string { return fmt.Sprintf("/%d", n) },
-	parChapters: 1,
-	parPages:    1}
+type mockmanga struct{}
+
+func (mockmanga) ChapterURL(manga string, chapter chapter.ID) string {
+	return fmt.Sprintf("%s/%s/%s/1", tsPage.URL, manga, chapter)
+}
+
+func (mockmanga) PageList(manga string, chapter chapter.ID, doc *goquery.Document) []string {
+	var links []string
+	doc.Find("select#pageList").First().Find("option").Each(func(i int, s *goquery.Selection) {
+		link, _ := s.Attr("value")
+		formattedLink := fmt.Sprintf("%s://%s%s", doc.Url.Scheme, doc.Url.Host, link)
+		links = append(links, formattedLink)
+	})
+	return links
+}
+
+func (mockmanga) Image(doc *goquery.Document) (string, error) {
+	imageURL, found := doc.Find("#image").Attr("src")
+	if !found {
+		return "", site.ErrImageNotFound
+	}
+	return imageURL, nil
+}
+
+func (mockmanga) Info() site.Info {
+	return site.Info{
+		URL:         tsPage.URL + "/",
+		ParChapters: 1,
+		ParPages:    1}
+}
+
+/* mockseries is a mockmanga which can also list its chapters */
+type mockseries struct {
+	mockmanga
+	url string
+}
+
+func (m mockseries) SeriesURL(manga string) string {
+	return m.url + "/" + manga
+}
+
+func (mockseries) Index(manga string, doc *goquery.Document) (*site.Series, error) {
+	series := &site.Series{Title: doc.Find("h1").Text()}
+	doc.Find("li a").Each(func(i int, s *goquery.Selection) {
+		id, _ := site.ChapterNumber(s.Text())
+		href, _ := s.Attr("href")
+		series.Chapters = append(series.Chapters, site.Chapter{ID: id, Title: s.Text(), URL: href})
+	})
+	return series, nil
+}
+
+/* failingmanga is a mockmanga whose chapter 2 is missing */
+type failingmanga struct {
+	mockmanga
+	missing string
+}
+
+func (m failingmanga) ChapterURL(manga string, chapter chapter.ID) string {
+	if chapter == "2" {
+		return m.missing
+	}
+	return m.mockmanga.ChapterURL(manga, chapter)
+}
 
 func zipReader(b []byte) []DownloadResult {
 	var output []DownloadResult
@@ -111,7 +165,7 @@ func TestMockPage(t *testing.T) {
 	resp, _ := http.Get(tsPage.URL)
 	doc, _ := goquery.NewDocumentFromResponse(resp)
 
-	img := mockmanga.img(doc)
+	img, _ := mockmanga{}.Image(doc)
 	expectImg := tsImage.URL
 	if !reflect.DeepEqual(img, expectImg) {
 		fmt.Printf("Got: %s\n", img)
@@ -119,7 +173,7 @@ func TestMockPage(t *testing.T) {
 		t.Fail()
 	}
 
-	pageList := mockmanga.pageList("", 1, doc)
+	pageList := mockmanga{}.PageList("", "1", doc)
 	expectLinks := []string{
 		tsPage.URL + "/page1",
 		tsPage.URL + "/page2",
@@ -131,8 +185,96 @@ func TestMockPage(t *testing.T) {
 	}
 }
 
+func TestGetSeries(t *testing.T) {
+	tsSeries := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<h1>%s</h1><ul><li><a href="/1">Chapter 1</a></li><li><a href="/2">Chapter 2</a></li></ul>`, r.URL.Path[1:])
+	}))
+	defer tsSeries.Close()
+
+	got, err := getSeries(context.Background(), testClient, mockseries{url: tsSeries.URL}, "manga-name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := &site.Series{
+		Title: "manga-name",
+		Chapters: []site.Chapter{
+			{ID: "1", Title: "Chapter 1", URL: "/1"},
+			{ID: "2", Title: "Chapter 2", URL: "/2"}}}
+	if !reflect.DeepEqual(expect, got) {
+		fmt.Printf("Got: %v\n", got)
+		fmt.Printf("Expect: %v\n", expect)
+		t.Fail()
+	}
+
+	/* sites without a chapter list */
+	if _, err := getSeries(context.Background(), testClient, mockmanga{}, "manga-name"); err == nil {
+		t.Error("getSeries succeeded on a site without an index")
+	}
+}
+
+func TestChapterRange(t *testing.T) {
+	tsSeries := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<ul><li><a href="/1">1</a></li><li><a href="/2">2</a></li><li><a href="/2.5">2.5</a></li><li><a href="/3">3</a></li><li><a href="/5">5</a></li></ul>`)
+	}))
+	defer tsSeries.Close()
+
+	for _, c := range []struct {
+		s      site.Site
+		expr   string
+		expect []chapter.ID
+	}{
+		{mockseries{url: tsSeries.URL}, "2-4", []chapter.ID{"2", "2.5", "3"}},
+		{mockseries{url: tsSeries.URL}, "latest-2,1", []chapter.ID{"1", "3", "5"}},
+		{mockseries{url: tsSeries.URL}, "2.5..", []chapter.ID{"2.5", "3", "5"}},
+		{mockmanga{}, "2-4,7", []chapter.ID{"2", "3", "4", "7"}},
+	} {
+		got, _, err := chapterRange(context.Background(), testClient, c.s, "manga-name", c.expr)
+		if err != nil || !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("%s: got %v %v, expect %v", c.expr, got, err, c.expect)
+		}
+	}
+
+	for _, c := range []struct {
+		s    site.Site
+		expr string
+	}{
+		{mockseries{url: tsSeries.URL}, "4"},
+		{mockseries{url: tsSeries.URL}, "6-"},
+		{mockmanga{}, "latest"},
+		{mockmanga{}, "5-x"},
+	} {
+		if _, _, err := chapterRange(context.Background(), testClient, c.s, "manga-name", c.expr); err == nil {
+			t.Errorf("%s: no error", c.expr)
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	if got := pageName("10.5", 2, imageBuffer.Bytes()); got != "image-010.5-002.jpg" {
+		t.Errorf("pageName: %s", got)
+	}
+	if got := pageName("1", 2, []byte("\x89PNG\r\n\x1a\n")); got != "image-001-002.png" {
+		t.Errorf("pageName: %s", got)
+	}
+	if got := cbzName("manga/name", []chapter.ID{"1"}); got != "manga_name-001.cbz" {
+		t.Errorf("cbzName: %s", got)
+	}
+	if got := cbzName("manga", []chapter.ID{"9", "10.5", "oneshot"}); got != "manga-009-oneshot.cbz" {
+		t.Errorf("cbzName: %s", got)
+	}
+	if got := journalName("manga/name", "12-"); got != "manga_name-12-.journal" {
+		t.Errorf("Got: %s", got)
+	}
+	if got := journalName("manga", "latest-5, 1"); got != "manga-latest-5,1.journal" {
+		t.Errorf("Got: %s", got)
+	}
+}
+
 func TestDownloadImage(t *testing.T) {
-	got := downloadImage(tsImage.URL)
+	got, err := downloadImage(context.Background(), testClient, tsImage.URL, tsPage.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	expect := imageBuffer.Bytes()
 	if !reflect.DeepEqual(got, expect) {
@@ -144,9 +286,10 @@ func TestDownloadImage(t *testing.T) {
 }
 
 func TestGetFirstPage(t *testing.T) {
-	sites["mockmanga"] = mockmanga
-
-	links, pageImageBytes := getFirstPage("mockmanga", "manga-name", 1)
+	links, pageImageBytes, err := getFirstPage(context.Background(), testClient, mockmanga{}, "manga-name", "1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	expectLinks := []string{
 		tsPage.URL + "/page1",
@@ -167,20 +310,19 @@ func TestGetFirstPage(t *testing.T) {
 }
 
 func TestDownloadPage(t *testing.T) {
-	sites["mockmanga"] = mockmanga
 	numJobs := 3
 
 	dljob := make(chan DownloadJob, numJobs)
 	dljob <- DownloadJob{
-		Chapter: 1,
+		Chapter: "1",
 		Page:    1,
 		Link:    tsPage.URL}
 	dljob <- DownloadJob{
-		Chapter: 1,
+		Chapter: "1",
 		Page:    2,
 		Link:    tsPage.URL}
 	dljob <- DownloadJob{
-		Chapter: 2,
+		Chapter: "2",
 		Page:    1,
 		Link:    tsPage.URL}
 	close(dljob)
@@ -188,11 +330,12 @@ func TestDownloadPage(t *testing.T) {
 	var wg sync.WaitGroup
 	wg.Add(numJobs)
 
-	go downloadPage(1, "mockmanga", dljob, result, &wg)
+	go downloadPage(context.Background(), 1, testClient, mockmanga{}, nil, dljob, result, &wg)
 	wg.Wait()
 
 	got := <-result
 	expect := DownloadResult{
+		Chapter: "1",
 		Name:    "image-001-001.jpg",
 		Content: imageBuffer.Bytes()}
 	if !reflect.DeepEqual(got, expect) {
@@ -203,6 +346,7 @@ func TestDownloadPage(t *testing.T) {
 
 	got = <-result
 	expect = DownloadResult{
+		Chapter: "1",
 		Name:    "image-001-002.jpg",
 		Content: imageBuffer.Bytes()}
 	if !reflect.DeepEqual(got, expect) {
@@ -213,6 +357,7 @@ func TestDownloadPage(t *testing.T) {
 
 	got = <-result
 	expect = DownloadResult{
+		Chapter: "2",
 		Name:    "image-002-001.jpg",
 		Content: imageBuffer.Bytes()}
 	if !reflect.DeepEqual(got, expect) {
@@ -223,27 +368,30 @@ func TestDownloadPage(t *testing.T) {
 }
 
 func TestDownloadChapter(t *testing.T) {
-	sites["mockmanga"] = mockmanga
 	numChapters := 3
 
-	chapters := make(chan int, numChapters)
+	chapters := make(chan chapter.ID, numChapters)
 	downloadedPages := make(chan DownloadResult, 3*numChapters)
-	var wg sync.WaitGroup
+	chapterResults := make(chan ChapterResult, numChapters)
 
 	for i := 1; i <= numChapters; i++ {
-		chapters <- i
+		chapters <- chapter.FromInt(i)
 	}
 	close(chapters)
 
-	wg.Add(numChapters)
-	go downloadChapter("mockmanga", "manga_test", chapters, downloadedPages, 1, &wg)
-	wg.Wait()
+	go downloadChapter(context.Background(), testClient, mockmanga{}, "manga_test", nil, nil, chapters, downloadedPages, chapterResults, 1)
+	for i := 1; i <= numChapters; i++ {
+		if result := <-chapterResults; result.Err != nil {
+			t.Errorf("Chapter %s: %v", result.Chapter, result.Err)
+		}
+	}
 	close(downloadedPages)
 
 	var expect []DownloadResult
 	for c := 1; c <= 3; c++ {
 		for p := 0; p <= 2; p++ {
 			expect = append(expect, DownloadResult{
+				Chapter: chapter.FromInt(c),
 				Name:    fmt.Sprintf("image-%03d-%03d.jpg", c, p),
 				Content: imageBuffer.Bytes()})
 		}
@@ -261,196 +409,274 @@ func TestDownloadChapter(t *testing.T) {
 	}
 }
 
-func TestCbzChan(t *testing.T) {
-	/* test using buffer instead of file */
-	var buf bytes.Buffer
-
-	/* expected result */
-	expect := []DownloadResult{
-		DownloadResult{
-			Name:    "image-001-001.jpg",
-			Content: imageBuffer.Bytes()},
-		DownloadResult{
-			Name:    "image-001-002.jpg",
-			Content: imageBuffer.Bytes()},
-		DownloadResult{
-			Name:    "image-002-001.jpg",
-			Content: imageBuffer.Bytes()}}
-
-	/* create, fill, and close results channel */
-	downloadedPages := make(chan DownloadResult, 3)
-	for _, res := range expect {
-		downloadedPages <- res
+func TestProcessChapter(t *testing.T) {
+	pages := []DownloadResult{
+		{Chapter: "1", Name: "image-001-000.jpg", Content: imageBuffer.Bytes()},
+		{Chapter: "1", Name: "image-001-001.jpg", Content: imageBuffer.Bytes()}}
+	if got, err := processChapter(nil, "1", pages); err != nil || !reflect.DeepEqual(got, pages) {
+		t.Errorf("Got %v, %v without pipeline", got, err)
 	}
-	close(downloadedPages)
 
-	/* TEST */
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go cbzChan(&buf, downloadedPages, &wg)
-	wg.Wait()
+	pipeline, err := newPipeline(pipelineOptions{Format: "png", MaxWidth: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := processChapter(pipeline, "1", pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, page := range got {
+		if expect := fmt.Sprintf("image-001-%03d.png", i); page.Name != expect {
+			t.Errorf("Got %s, expect %s", page.Name, expect)
+		}
+	}
 
-	/* read the result zip archive */
-	got := zipReader(buf.Bytes())
+	if _, err := processChapter(&process.Pipeline{Output: process.Output{Format: "gif"}}, "1", pages); err == nil || fetch.Retryable(err) {
+		t.Errorf("Got %v for a failing pipeline, expect a permanent error", err)
+	}
 
-	/* got == expect ? */
-	if !reflect.DeepEqual(expect, got) {
-		fmt.Printf("Got: %s\n", got)
-		fmt.Printf("Expect: %s\n", expect)
-		t.Fail()
+	if pipeline, err := newPipeline(pipelineOptions{}); pipeline != nil || err != nil {
+		t.Errorf("Got %v, %v without options, expect no pipeline", pipeline, err)
+	}
+	if _, err := newPipeline(pipelineOptions{Quality: 101}); err == nil {
+		t.Error("quality 101 accepted")
+	}
+	if _, err := newPipeline(pipelineOptions{Profile: "etch-a-sketch"}); err == nil {
+		t.Error("unknown profile accepted")
+	}
+	if _, err := newPipeline(pipelineOptions{Spreads: "up"}); err == nil {
+		t.Error("unknown reading order accepted")
+	}
+	if _, err := newPipeline(pipelineOptions{Trim: true, TrimMin: 2}); err == nil {
+		t.Error("trim minimum 2 accepted")
 	}
 }
 
-func TestComicextra(t *testing.T) {
-	t.Run("Image", func(t *testing.T) {
-		/* Image URL */
-		html := `
-		<img id="main_img" class="chapter_img" src="http://2.bp.blogspot.com/g4M04SEdkwl1iGNHuRIq2PvqIdTIKuX5sjGPgVaQQmOJXu793uilskOe6cABXqKfAwy1wi4g-qzE=s0" data-width="820" alt="Valerian and Laureline 1 Page 1" style="width: 100%;">
-		`
-		htmlDocument, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
-		expect := "http://2.bp.blogspot.com/g4M04SEdkwl1iGNHuRIq2PvqIdTIKuX5sjGPgVaQQmOJXu793uilskOe6cABXqKfAwy1wi4g-qzE=s0"
-		got := comicextra.img(htmlDocument)
-		if !reflect.DeepEqual(expect, got) {
-			fmt.Printf("Got: %s\n", got)
-			fmt.Printf("Expect: %s\n", expect)
-			t.Fail()
-		}
-	})
+func TestMetadataBookTitle(t *testing.T) {
+	metadata := &Metadata{
+		Manga: "naruto",
+		Series: &site.Series{
+			Title:    "Naruto",
+			Chapters: []site.Chapter{{ID: "1", Title: "Uzumaki Naruto"}}}}
+	if got := metadata.BookTitle([]chapter.ID{"1"}); got != "Naruto Chapter 1: Uzumaki Naruto" {
+		t.Errorf("Got: %s", got)
+	}
+	if got := metadata.BookTitle([]chapter.ID{"1", "2"}); got != "Naruto Chapters 1-2" {
+		t.Errorf("Got: %s", got)
+	}
+	if got := (&Metadata{Manga: "naruto"}).BookTitle([]chapter.ID{"2"}); got != "naruto Chapter 2" {
+		t.Errorf("Got: %s", got)
+	}
+}
 
-	t.Run("PageList", func(t *testing.T) {
-		/* Page list */
-		html := `
-		<select name="page_select" class="full-select"><option selected="selected">1 </option></select>
-		<select name="page_select" class="full-select"><option value="http://www.comicextra.com/valerian-and-laureline/chapter-1" selected="selected">1 </option><option value="http://www.comicextra.com/valerian-and-laureline/chapter-1/2">2 </option><option value="http://www.comicextra.com/valerian-and-laureline/chapter-1/3">3 </option></select>
-		`
-		htmlDocument, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
-		expectArray := []string{
-			"http://www.comicextra.com/valerian-and-laureline/chapter-1",
-			"http://www.comicextra.com/valerian-and-laureline/chapter-1/2",
-			"http://www.comicextra.com/valerian-and-laureline/chapter-1/3",
-		}
-		gotArray := comicextra.pageList("manga", 1, htmlDocument)
-		if !reflect.DeepEqual(expectArray, gotArray) {
-			fmt.Printf("Got: %s\n", gotArray)
-			fmt.Printf("Expect: %s\n", expectArray)
-			t.Fail()
-		}
-	})
+func TestMetadataComicInfo(t *testing.T) {
+	metadata := &Metadata{
+		Manga: "naruto",
+		URL:   "http://example.com/naruto",
+		Series: &site.Series{
+			Title:   "Naruto",
+			Authors: []string{"Kishimoto Masashi"},
+			Chapters: []site.Chapter{
+				{ID: "1", Title: "Uzumaki Naruto", URL: "http://example.com/naruto/1", Volume: "1"},
+				{ID: "2", Title: "Konohamaru", Volume: "1"},
+				{ID: "10", Volume: "2"}}}}
+
+	got := metadata.ComicInfo([]chapter.ID{"1"})
+	if got.Series != "Naruto" || got.Number != "1" || got.Title != "Uzumaki Naruto" || got.Volume != "1" ||
+		got.Writer != "Kishimoto Masashi" || got.Web != "http://example.com/naruto/1" {
+		t.Errorf("Single chapter: got %+v", got)
+	}
+	got = metadata.ComicInfo([]chapter.ID{"1", "2"})
+	if got.Number != "" || got.Title != "Chapters 1-2" || got.Volume != "1" || got.Web != "http://example.com/naruto" {
+		t.Errorf("Chapters of a volume: got %+v", got)
+	}
+	if got = metadata.ComicInfo([]chapter.ID{"2", "10"}); got.Volume != "" {
+		t.Errorf("Chapters of two volumes: got volume %s", got.Volume)
+	}
+}
+
+func TestArchiveNames(t *testing.T) {
+	chapters := []chapter.ID{"1", "2", "2.5", "3"}
+	if archiveNames("none", "manga", chapters, nil) != nil {
+		t.Error("split none has archive names")
+	}
 
-	t.Run("URL", func(t *testing.T) {
-		manga := "valerian-and-laureline"
-		got := comicextra.url + manga + comicextra.chapter(1) + comicextra.page("1")
-		expect := "http://www.comicextra.com/valerian-and-laureline/chapter-1/1"
-		if !reflect.DeepEqual(expect, got) {
-			fmt.Printf("Got: %s\n", got)
-			fmt.Printf("Expect: %s\n", expect)
-			t.Fail()
+	byChapter := archiveNames("chapter", "manga", chapters, nil)
+	if got := byChapter("2.5"); got != "manga-002.5.cbz" {
+		t.Errorf("chapter: %s", got)
+	}
+
+	/* volumes from a mapping file */
+	file := filepath.Join(t.TempDir(), "volumes.txt")
+	ioutil.WriteFile(file, []byte("1: 1-2\n2: 2.5\n"), 0644)
+	volumes, err := chapterVolumes(nil, "manga", file, chapters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byVolume := archiveNames("volume", "manga", chapters, volumes)
+	for c, expect := range map[chapter.ID]string{
+		"1":   "manga-v01.cbz",
+		"2":   "manga-v01.cbz",
+		"2.5": "manga-v02.cbz",
+		"3":   "manga-003.cbz",
+	} {
+		if got := byVolume(c); got != expect {
+			t.Errorf("volume of %s: got %s, expect %s", c, got, expect)
 		}
-	})
+	}
+
+	/* sites without volumes need a mapping file */
+	if _, err := chapterVolumes(nil, "manga", "", chapters); err == nil {
+		t.Error("volumes found without a chapter list")
+	}
 }
 
-func TestMangareader(t *testing.T) {
-	t.Run("Image", func(t *testing.T) {
-		/* Image URL */
-		html := `
-		<img id="img" width="800" height="1263" src="http://i10.mangareader.net/naruto/1/naruto-1564773.jpg" alt="Naruto 1 - Page 1" name="img">
-		`
-		htmlDocument, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
-		expect := "http://i10.mangareader.net/naruto/1/naruto-1564773.jpg"
-		got := mangareader.img(htmlDocument)
-		if !reflect.DeepEqual(expect, got) {
-			fmt.Printf("Got: %s\n", got)
-			fmt.Printf("Expect: %s\n", expect)
-			t.Fail()
+func TestDownloadChaptersErrors(t *testing.T) {
+	var missingHits int
+	var mu sync.Mutex
+	tsMissing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		missingHits++
+		mu.Unlock()
+		http.NotFound(w, r)
+	}))
+	defer tsMissing.Close()
+	s := failingmanga{missing: tsMissing.URL}
+	chapters := []chapter.ID{"1", "2", "3"}
+
+	for _, c := range []struct {
+		onError      string
+		expectHits   int
+		expectAbort  bool
+		expectPages  int
+		numChWorkers int
+	}{
+		{onErrorSkip, 1, false, 6, 2},
+		/* a missing page is not retried */
+		{onErrorRetry, 1, false, 6, 2},
+		{onErrorAbort, 1, true, 3, 1},
+	} {
+		missingHits = 0
+		file := filepath.Join(t.TempDir(), "out.cbz")
+		err := downloadChapters(context.Background(), testClient, s, "manga", chapters, func(chapter.ID) string { return file }, downloadOptions{Output: Output{Format: outputCBZ}, OnError: c.onError, Retries: 2}, c.numChWorkers, 1)
+
+		downloadErr, ok := err.(*DownloadError)
+		if !ok {
+			t.Fatalf("%s: got error %v", c.onError, err)
 		}
-	})
-
-	t.Run("PageList", func(t *testing.T) {
-		/* Page list */
-		html := `
-		<select id="pageMenu" name="pageMenu"><option value="/naruto/1" selected="selected">1</option>
-		<option value="/naruto/1/2">2</option>
-		<option value="/naruto/1/3">3</option>
-		</select>
-		<select id="pageMenu" name="pageMenu"><option value="/naruto/1" selected="selected">1</option>
-		<option value="/naruto/1/2">2</option>
-		<option value="/naruto/1/3">3</option>
-		</select>
-		`
-		htmlDocument, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
-		expect := []string{
-			"http://www.mangareader.net/naruto/1",
-			"http://www.mangareader.net/naruto/1/2",
-			"http://www.mangareader.net/naruto/1/3",
+		if !reflect.DeepEqual(downloadErr.Failed, []chapter.ID{"2"}) || downloadErr.Aborted != c.expectAbort {
+			t.Errorf("%s: got %+v", c.onError, downloadErr)
 		}
-		got := mangareader.pageList("manga", 1, htmlDocument)
-		if !reflect.DeepEqual(expect, got) {
-			fmt.Printf("Got: %s\n", got)
-			fmt.Printf("Expect: %s\n", expect)
-			t.Fail()
+		if missingHits != c.expectHits {
+			t.Errorf("%s: chapter 2 tried %d times, expect %d", c.onError, missingHits, c.expectHits)
 		}
-	})
 
-	t.Run("URL", func(t *testing.T) {
-		manga := "naruto"
-		got := mangareader.url + manga + mangareader.chapter(1) + mangareader.page("1")
-		expect := "http://www.mangareader.net/naruto/1/1"
-		if !reflect.DeepEqual(expect, got) {
-			fmt.Printf("Got: %s\n", got)
-			fmt.Printf("Expect: %s\n", expect)
-			t.Fail()
+		/* the archive only has the complete chapters */
+		b, _ := ioutil.ReadFile(file)
+		pages := zipReader(b)
+		if len(pages) != c.expectPages {
+			t.Errorf("%s: got %d pages, expect %d", c.onError, len(pages), c.expectPages)
 		}
-	})
+		for _, page := range pages {
+			if strings.HasPrefix(page.Name, "image-002") {
+				t.Errorf("%s: failed chapter in archive: %s", c.onError, page.Name)
+			}
+		}
+	}
 }
 
-func TestMangafox(t *testing.T) {
-	t.Run("Image", func(t *testing.T) {
-		/* Image link */
-		html := `
-		<img src="http://l.mfcdn.net/store/manga/8/01-001.0/compressed/naruto_v01_ch001_005.jpg?token=b0a60425c24cdb15e3a0d5681cd41b188d0d8a59&amp;ttl=1501300800" width="671" id="image" alt="Naruto 1: Uzumaki Naruto at MangaFox.me">
-		`
-		htmlDocument, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
-		expect := "http://l.mfcdn.net/store/manga/8/01-001.0/compressed/naruto_v01_ch001_005.jpg?token=b0a60425c24cdb15e3a0d5681cd41b188d0d8a59&ttl=1501300800"
-		got := mangafox.img(htmlDocument)
-		if !reflect.DeepEqual(expect, got) {
-			fmt.Printf("Got: %s\n", got)
-			fmt.Printf("Expect: %s\n", expect)
-			t.Fail()
-		}
-	})
+func TestDownloadChaptersRetryable(t *testing.T) {
+	/* a chapter which is unavailable for now is retried */
+	var hits int
+	var mu sync.Mutex
+	tsUnavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits++
+		mu.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer tsUnavailable.Close()
+	client, _ := fetch.New(fetch.Config{Retry: fetch.RetryPolicy{Attempts: 1}})
+
+	file := filepath.Join(t.TempDir(), "out.cbz")
+	err := downloadChapters(context.Background(), client, failingmanga{missing: tsUnavailable.URL}, "manga", []chapter.ID{"1", "2"}, func(chapter.ID) string { return file }, downloadOptions{Output: Output{Format: outputCBZ}, OnError: onErrorRetry, Retries: 2}, 1, 1)
+	if downloadErr, ok := err.(*DownloadError); !ok || !reflect.DeepEqual(downloadErr.Failed, []chapter.ID{"2"}) {
+		t.Fatalf("Got error %v", err)
+	}
+	if hits != 3 {
+		t.Errorf("Chapter 2 tried %d times, expect 3", hits)
+	}
+}
 
-	t.Run("PageList", func(t *testing.T) {
-		/* Page list */
-		html := `
-		<select onchange="change_page(this)" class="m">
-		<option value="1" selected="selected">1</option><option value="2">2</option><option value="3">3</option><option value="0">Comments</option>
-		</select>
-		<select onchange="change_page(this)" class="m">
-		<option value="1" selected="selected">1</option><option value="2">2</option><option value="3">3</option><option value="0">Comments</option>
-		</select>
-		`
-		htmlDocument, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
-		expect := []string{
-			"http://mangafox.me/manga/naruto/c001/1.html",
-			"http://mangafox.me/manga/naruto/c001/2.html",
-			"http://mangafox.me/manga/naruto/c001/3.html",
-		}
-		got := mangafox.pageList("naruto", 1, htmlDocument)
-		if !reflect.DeepEqual(expect, got) {
-			fmt.Printf("Got: %s\n", got)
-			fmt.Printf("Expect: %s\n", expect)
-			t.Fail()
-		}
-	})
+func TestDownloadChaptersCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	file := filepath.Join(t.TempDir(), "out.cbz")
+	chapters := []chapter.ID{"1", "2", "3"}
+	err := downloadChapters(ctx, testClient, mockmanga{}, "manga", chapters, func(chapter.ID) string { return file }, downloadOptions{Output: Output{Format: outputCBZ}, OnError: onErrorRetry, Retries: 2}, 2, 1)
 
-	t.Run("URL", func(t *testing.T) {
-		manga := "naruto"
-		got := mangafox.url + manga + mangafox.chapter(1) + mangafox.page("1")
-		expect := "http://mangafox.me/manga/naruto/c001/1.html"
-		if !reflect.DeepEqual(expect, got) {
-			fmt.Printf("Got: %s\n", got)
-			fmt.Printf("Expect: %s\n", expect)
-			t.Fail()
+	downloadErr, ok := err.(*DownloadError)
+	if !ok {
+		t.Fatalf("Got error %v", err)
+	}
+	if !reflect.DeepEqual(downloadErr.Cancelled, chapters) || len(downloadErr.Failed) > 0 {
+		t.Errorf("Got %+v", downloadErr)
+	}
+
+	/* no chapters were written, but the archive is still finalized */
+	if b, err := ioutil.ReadFile(file); err == nil {
+		if _, err := zip.NewReader(bytes.NewReader(b), int64(len(b))); err != nil {
+			t.Error("Invalid archive:", err)
 		}
-	})
+	}
+}
+
+func TestDownloadChaptersResume(t *testing.T) {
+	var pageHits int
+	var mu sync.Mutex
+	tsCounted := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		pageHits++
+		mu.Unlock()
+		fmt.Fprintf(w, pageHTML, tsImage.URL)
+	}))
+	defer tsCounted.Close()
+	tsMissing := httptest.NewServer(http.NotFoundHandler())
+	defer tsMissing.Close()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "out.cbz")
+	chapters := []chapter.ID{"1", "2", "3"}
+
+	/* chapter 2 fails in the first download */
+	j, err := journal.Open(filepath.Join(dir, "out.journal"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = downloadChapters(context.Background(), testClient, failingmanga{missing: tsMissing.URL}, "manga", chapters, func(chapter.ID) string { return file }, downloadOptions{Output: Output{Format: outputCBZ}, Journal: j, OnError: onErrorSkip}, 1, 1)
+	if _, ok := err.(*DownloadError); !ok {
+		t.Fatalf("Got error %v", err)
+	}
+	j.Close()
+
+	/* the resumed download only gets chapter 2 */
+	j, err = journal.Open(filepath.Join(dir, "out.journal"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := failingmanga{missing: tsCounted.URL + "/manga/2/1"}
+	if err := downloadChapters(context.Background(), testClient, s, "manga", chapters, func(chapter.ID) string { return file }, downloadOptions{Output: Output{Format: outputCBZ}, Journal: j, OnError: onErrorSkip}, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	/* the first page of chapter 2, and its 2 other pages */
+	if pageHits != 3 {
+		t.Errorf("Got %d page downloads, expect 3", pageHits)
+	}
+	b, _ := ioutil.ReadFile(file)
+	if pages := zipReader(b); len(pages) != 9 {
+		t.Errorf("Got %d pages, expect 9", len(pages))
+	}
 }
@@ -0,0 +1,302 @@
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"mangadl/imagetype"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// Metadata is the metadata of a document
+type Metadata struct {
+	Title       string
+	Authors     []string
+	Description string
+	RightToLeft bool
+}
+
+// ErrImage is returned by AddPage for an image which cannot be embedded,
+// such as an AVIF image; the document is still complete without its page
+var ErrImage = errors.New("cannot embed image")
+
+// Writer writes a PDF document of one image per page, each page the size of
+// its image at 72 dpi. JPEG images are embedded as they are, other images
+// are compressed without loss. The images are written as they are added, in
+// any order; the pages are sorted by name when the document is closed, with
+// an outline entry at the first page of every chapter. Metadata is written
+// when the document is closed, so that it can be completed once the pages are
+// known.
+type Writer struct {
+	Metadata Metadata
+	w        *bufio.Writer
+	n        int64
+	err      error
+	offsets  []int64
+	pages    []page
+}
+
+type page struct {
+	name          string
+	chapter       string
+	image         int
+	width, height int
+}
+
+// NewWriter starts a document written to w
+func NewWriter(w io.Writer, metadata Metadata) (*Writer, error) {
+	writer := &Writer{Metadata: metadata, w: bufio.NewWriter(w)}
+	/* the binary comment tells transfer programs that the file is binary */
+	writer.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+	return writer, writer.err
+}
+
+func (w *Writer) write(data []byte) {
+	if w.err != nil {
+		return
+	}
+	var n int
+	n, w.err = w.w.Write(data)
+	w.n += int64(n)
+}
+
+func (w *Writer) printf(format string, args ...interface{}) {
+	w.write([]byte(fmt.Sprintf(format, args...)))
+}
+
+// object allocates the number of an object written later
+func (w *Writer) object() int {
+	w.offsets = append(w.offsets, -1)
+	return len(w.offsets)
+}
+
+// begin starts the object numbered id at the current offset
+func (w *Writer) begin(id int) {
+	w.offsets[id-1] = w.n
+	w.printf("%d 0 obj\n", id)
+}
+
+// stream writes the object numbered id, a stream of data with the entries
+// of dict
+func (w *Writer) stream(id int, dict string, data []byte) {
+	w.begin(id)
+	w.printf("<< %s /Length %d >>\nstream\n", dict, len(data))
+	w.write(data)
+	w.printf("\nendstream\nendobj\n")
+}
+
+// AddPage adds the image of a page. chapter is the title of the chapter of
+// the page in the outline.
+func (w *Writer) AddPage(name, chapter string, data []byte) error {
+	if w.err != nil {
+		return w.err
+	}
+	dict, stream, width, height, err := imageStream(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w: %v", name, ErrImage, err)
+	}
+	p := page{name: path.Base(name), chapter: chapter, image: w.object(), width: width, height: height}
+	w.stream(p.image, dict, stream)
+	w.pages = append(w.pages, p)
+	return w.err
+}
+
+// imageStream returns the dictionary entries and data of the image XObject
+// of an image
+func imageStream(data []byte) (string, []byte, int, int, error) {
+	t, err := imagetype.Sniff(data)
+	if err != nil {
+		return "", nil, 0, 0, err
+	}
+
+	/* JPEG is a PDF filter, the image is embedded as it is */
+	if t == imagetype.JPEG {
+		config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return "", nil, 0, 0, err
+		}
+		var space string
+		switch config.ColorModel {
+		case color.GrayModel:
+			space = "/DeviceGray"
+		case color.CMYKModel:
+			/* CMYK JPEGs are written inverted by Adobe software */
+			space = "/DeviceCMYK /Decode [1 0 1 0 1 0 1 0]"
+		default:
+			space = "/DeviceRGB"
+		}
+		dict := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter /DCTDecode",
+			config.Width, config.Height, space)
+		return dict, data, config.Width, config.Height, nil
+	}
+
+	/* other images are decoded to samples compressed without loss */
+	img, _, err := imagetype.Decode(data)
+	if err != nil {
+		return "", nil, 0, 0, err
+	}
+	bounds := img.Bounds()
+	var samples bytes.Buffer
+	z := zlib.NewWriter(&samples)
+	space := "/DeviceRGB"
+	if gray, ok := img.(*image.Gray); ok {
+		space = "/DeviceGray"
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			i := gray.PixOffset(bounds.Min.X, y)
+			z.Write(gray.Pix[i : i+bounds.Dx()])
+		}
+	} else {
+		row := make([]byte, 3*bounds.Dx())
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				/* transparent pages are shown on white, like on paper */
+				r, g, b, a := img.At(x, y).RGBA()
+				i := 3 * (x - bounds.Min.X)
+				row[i] = onWhite(r, a)
+				row[i+1] = onWhite(g, a)
+				row[i+2] = onWhite(b, a)
+			}
+			z.Write(row)
+		}
+	}
+	if err := z.Close(); err != nil {
+		return "", nil, 0, 0, err
+	}
+	dict := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter /FlateDecode",
+		bounds.Dx(), bounds.Dy(), space)
+	return dict, samples.Bytes(), bounds.Dx(), bounds.Dy(), nil
+}
+
+// onWhite returns the 8 bit value of an alpha premultiplied 16 bit component
+// over a white background
+func onWhite(c, a uint32) byte {
+	return byte((c + 0xffff - a) >> 8)
+}
+
+// Close writes the pages, outline and document catalog, and flushes the
+// document. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	sort.Slice(w.pages, func(i, j int) bool {
+		return w.pages[i].name < w.pages[j].name
+	})
+
+	/* pages */
+	pagesID := w.object()
+	pageIDs := make([]int, len(w.pages))
+	for i, p := range w.pages {
+		content := w.object()
+		w.stream(content, "", []byte(fmt.Sprintf("q %d 0 0 %d 0 0 cm /Im Do Q", p.width, p.height)))
+		pageIDs[i] = w.object()
+		w.begin(pageIDs[i])
+		w.printf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %d %d] /Resources << /XObject << /Im %d 0 R >> >> /Contents %d 0 R >>\nendobj\n",
+			pagesID, p.width, p.height, p.image, content)
+	}
+	w.begin(pagesID)
+	w.printf("<< /Type /Pages /Count %d /Kids [", len(pageIDs))
+	for _, id := range pageIDs {
+		w.printf(" %d 0 R", id)
+	}
+	w.printf(" ] >>\nendobj\n")
+
+	/* outline, an entry at the first page of every chapter */
+	var entries []int
+	for i, p := range w.pages {
+		if i == 0 || p.chapter != w.pages[i-1].chapter {
+			entries = append(entries, i)
+		}
+	}
+	outlines := 0
+	if len(entries) > 0 {
+		outlines = w.object()
+		first := len(w.offsets) + 1
+		for n, i := range entries {
+			id := w.object()
+			w.begin(id)
+			w.printf("<< /Title %s /Parent %d 0 R /Dest [%d 0 R /Fit]", text(w.pages[i].chapter), outlines, pageIDs[i])
+			if n > 0 {
+				w.printf(" /Prev %d 0 R", id-1)
+			}
+			if n < len(entries)-1 {
+				w.printf(" /Next %d 0 R", id+1)
+			}
+			w.printf(" >>\nendobj\n")
+		}
+		w.begin(outlines)
+		w.printf("<< /Type /Outlines /First %d 0 R /Last %d 0 R /Count %d >>\nendobj\n",
+			first, first+len(entries)-1, len(entries))
+	}
+
+	/* document information */
+	m := w.Metadata
+	info := w.object()
+	w.begin(info)
+	w.printf("<< /Producer %s", text("mangadl"))
+	if m.Title != "" {
+		w.printf(" /Title %s", text(m.Title))
+	}
+	if len(m.Authors) > 0 {
+		w.printf(" /Author %s", text(strings.Join(m.Authors, ", ")))
+	}
+	if m.Description != "" {
+		w.printf(" /Subject %s", text(m.Description))
+	}
+	w.printf(" >>\nendobj\n")
+
+	/* catalog */
+	catalog := w.object()
+	w.begin(catalog)
+	w.printf("<< /Type /Catalog /Pages %d 0 R", pagesID)
+	if outlines != 0 {
+		w.printf(" /Outlines %d 0 R /PageMode /UseOutlines", outlines)
+	}
+	if m.RightToLeft {
+		w.printf(" /ViewerPreferences << /Direction /R2L >>")
+	}
+	w.printf(" >>\nendobj\n")
+
+	/* cross-reference table */
+	xref := w.n
+	w.printf("xref\n0 %d\n0000000000 65535 f \n", len(w.offsets)+1)
+	for _, offset := range w.offsets {
+		w.printf("%010d 00000 n \n", offset)
+	}
+	w.printf("trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(w.offsets)+1, catalog, info, xref)
+
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+// text returns s as a PDF text string, literal if it is printable ASCII and
+// UTF-16 otherwise
+func text(s string) string {
+	ascii := true
+	for _, r := range s {
+		if r < 0x20 || r > 0x7e {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return "(" + strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(s) + ")"
+	}
+
+	var buf strings.Builder
+	buf.WriteString("<FEFF")
+	for _, u := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&buf, "%04X", u)
+	}
+	buf.WriteString(">")
+	return buf.String()
+}
@@ -0,0 +1,119 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	var gray, rgb, transparent bytes.Buffer
+	jpeg.Encode(&gray, image.NewGray(image.Rect(0, 0, 20, 30)), nil)
+	jpeg.Encode(&rgb, image.NewRGBA(image.Rect(0, 0, 40, 30)), nil)
+	png.Encode(&transparent, image.NewNRGBA(image.Rect(0, 0, 10, 10)))
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, Metadata{Title: "Naruto (1)", RightToLeft: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	/* pages out of order */
+	for _, p := range []struct {
+		name, chapter string
+		data          []byte
+	}{
+		{"image-002-001.png", "Chapter 2", transparent.Bytes()},
+		{"image-001-001.jpg", "Chapter 1: うずまきナルト", gray.Bytes()},
+		{"image-001-002.jpg", "Chapter 1: うずまきナルト", rgb.Bytes()},
+	} {
+		if err := w.AddPage(p.name, p.chapter, p.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.AddPage("page.html", "Chapter 3", []byte("<html>")); !errors.Is(err, ErrImage) {
+		t.Error("page without image accepted:", err)
+	}
+	w.Metadata.Authors = []string{"Kishimoto Masashi"}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	doc := buf.String()
+
+	t.Run("Structure", func(t *testing.T) {
+		if !strings.HasPrefix(doc, "%PDF-1.4\n") || !strings.HasSuffix(doc, "%%EOF\n") {
+			t.Fatal("Missing header or trailer")
+		}
+		/* every entry of the cross-reference table is the offset of its object */
+		match := regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(doc)
+		xref, _ := strconv.Atoi(match[1])
+		lines := strings.Split(doc[xref:], "\n")
+		size, _ := strconv.Atoi(strings.Fields(lines[1])[1])
+		for id := 1; id < size; id++ {
+			offset, _ := strconv.Atoi(lines[2+id][:10])
+			if expect := fmt.Sprintf("%d 0 obj\n", id); !strings.HasPrefix(doc[offset:], expect) {
+				t.Errorf("Object %d is not at offset %d", id, offset)
+			}
+		}
+	})
+
+	t.Run("Images", func(t *testing.T) {
+		/* JPEG images are embedded as they are */
+		if !strings.Contains(doc, "/ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /DCTDecode /Length "+strconv.Itoa(gray.Len())+" >>\nstream\n"+gray.String()) {
+			t.Error("Gray JPEG not embedded")
+		}
+		if !strings.Contains(doc, "/ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /DCTDecode /Length "+strconv.Itoa(rgb.Len())+" >>\nstream\n"+rgb.String()) {
+			t.Error("Color JPEG not embedded")
+		}
+		if !strings.Contains(doc, "/Width 10 /Height 10 /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode") {
+			t.Error("PNG not embedded")
+		}
+	})
+
+	t.Run("Pages", func(t *testing.T) {
+		boxes := regexp.MustCompile(`/MediaBox \[0 0 (\d+) (\d+)\]`).FindAllStringSubmatch(doc, -1)
+		var got []string
+		for _, box := range boxes {
+			got = append(got, box[1]+"x"+box[2])
+		}
+		if expect := "20x30 40x30 10x10"; strings.Join(got, " ") != expect {
+			t.Errorf("Got pages: %v, expect: %s", got, expect)
+		}
+	})
+
+	t.Run("Outline", func(t *testing.T) {
+		titles := regexp.MustCompile(`/Title (<\w+>|\([^)]*\)) /Parent`).FindAllStringSubmatch(doc, -1)
+		if len(titles) != 2 || titles[0][1] != "<FEFF004300680061007000740065007200200031003A00203046305A307E304D30CA30EB30C8>" || titles[1][1] != "(Chapter 2)" {
+			t.Errorf("Got outline: %v", titles)
+		}
+		for _, expect := range []string{"/Count 2", "/PageMode /UseOutlines", "/Direction /R2L", `/Title (Naruto \(1\))`, "/Author (Kishimoto Masashi)"} {
+			if !strings.Contains(doc, expect) {
+				t.Errorf("Missing %s", expect)
+			}
+		}
+	})
+}
+
+func TestOnWhite(t *testing.T) {
+	for _, c := range []struct {
+		color  color.Color
+		expect byte
+	}{
+		{color.NRGBA{0, 0, 0, 0}, 255},
+		{color.NRGBA{0, 0, 0, 255}, 0},
+		{color.NRGBA{0, 0, 0, 128}, 127},
+		{color.NRGBA{200, 0, 0, 255}, 200},
+	} {
+		r, _, _, a := c.color.RGBA()
+		if got := onWhite(r, a); got != c.expect {
+			t.Errorf("%v: got %d, expect %d", c.color, got, c.expect)
+		}
+	}
+}
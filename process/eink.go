@@ -0,0 +1,158 @@
+package process
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+)
+
+// Profile prepares pages for an e-ink device: grayscale, corrected for the
+// lighter rendering of e-ink screens, reduced to the gray levels of the
+// screen and scaled down to fit it
+type Profile struct {
+	Width, Height int
+	// Gamma above 1 darkens the mid tones
+	Gamma float64
+	// Contrast above 1 spreads the tones away from mid gray
+	Contrast float64
+	// Levels is the number of gray levels of the screen
+	Levels int
+	// Dither diffuses the error of reducing to Levels, else every pixel is
+	// rounded to the nearest level
+	Dither bool
+}
+
+// Profiles are the e-ink devices known by name
+var Profiles = map[string]Profile{
+	"kindle":            {Width: 600, Height: 800, Gamma: 1.8, Contrast: 1.1, Levels: 16, Dither: true},
+	"kindle-paperwhite": {Width: 1236, Height: 1648, Gamma: 1.8, Contrast: 1.1, Levels: 16, Dither: true},
+	"kindle-oasis":      {Width: 1264, Height: 1680, Gamma: 1.8, Contrast: 1.1, Levels: 16, Dither: true},
+	"kindle-scribe":     {Width: 1860, Height: 2480, Gamma: 1.8, Contrast: 1.1, Levels: 16, Dither: true},
+	"kobo-clara":        {Width: 1072, Height: 1448, Gamma: 1.8, Contrast: 1.1, Levels: 16, Dither: true},
+	"kobo-libra":        {Width: 1264, Height: 1680, Gamma: 1.8, Contrast: 1.1, Levels: 16, Dither: true},
+	"kobo-sage":         {Width: 1440, Height: 1920, Gamma: 1.8, Contrast: 1.1, Levels: 16, Dither: true},
+	"remarkable":        {Width: 1404, Height: 1872, Gamma: 1.6, Contrast: 1.1, Levels: 16, Dither: true},
+}
+
+// LookupProfile returns the profile of a device by name
+func LookupProfile(name string) (Profile, error) {
+	profile, found := Profiles[name]
+	if !found {
+		return Profile{}, fmt.Errorf("unknown profile %s", name)
+	}
+	return profile, nil
+}
+
+// Stages returns the stages preparing pages for the device
+func (p Profile) Stages() []Stage {
+	return []Stage{Each(func(img image.Image) image.Image {
+		gray := Fit(Grayscale(img), p.Width, p.Height).(*image.Gray)
+		p.adjust(gray)
+		if p.Dither {
+			return Dither(gray, p.Levels)
+		}
+		return Quantize(gray, p.Levels)
+	})}
+}
+
+// adjust applies the gamma and contrast correction in place
+func (p Profile) adjust(gray *image.Gray) {
+	var table [256]uint8
+	for i := range table {
+		v := float64(i) / 255
+		if p.Gamma > 0 {
+			v = math.Pow(v, p.Gamma)
+		}
+		if p.Contrast > 0 {
+			v = (v-0.5)*p.Contrast + 0.5
+		}
+		table[i] = clamp(v * 255)
+	}
+	for _, row := range rows(gray) {
+		for i, v := range row {
+			row[i] = table[v]
+		}
+	}
+}
+
+// rows returns the rows of pixels of a gray image, which only has part of
+// the pixels of its Pix slice when it is a sub-image
+func rows(gray *image.Gray) [][]uint8 {
+	b := gray.Bounds()
+	rows := make([][]uint8, b.Dy())
+	for y := range rows {
+		start := y * gray.Stride
+		rows[y] = gray.Pix[start : start+b.Dx()]
+	}
+	return rows
+}
+
+// Grayscale returns a gray copy of an image, even of a gray one, so that the
+// in place corrections of a Profile never change the original
+func Grayscale(img image.Image) *image.Gray {
+	b := img.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(gray, gray.Bounds(), img, b.Min, draw.Src)
+	return gray
+}
+
+// Quantize rounds every pixel of a gray image to the nearest of levels
+// evenly spaced gray levels, in place
+func Quantize(gray *image.Gray, levels int) *image.Gray {
+	if levels < 2 || levels >= 256 {
+		return gray
+	}
+	for _, row := range rows(gray) {
+		for i, v := range row {
+			row[i] = level(float64(v), levels)
+		}
+	}
+	return gray
+}
+
+// Dither reduces a gray image to levels evenly spaced gray levels with
+// Floyd-Steinberg error diffusion, in place
+func Dither(gray *image.Gray, levels int) *image.Gray {
+	if levels < 2 || levels >= 256 {
+		return gray
+	}
+	w := gray.Bounds().Dx()
+
+	/* errors of the current and next rows, with a pixel of margin each side */
+	current := make([]float64, w+2)
+	next := make([]float64, w+2)
+	for _, row := range rows(gray) {
+		for x := 0; x < w; x++ {
+			v := float64(row[x]) + current[x+1]
+			q := level(v, levels)
+			row[x] = q
+			e := v - float64(q)
+			current[x+2] += e * 7 / 16
+			next[x] += e * 3 / 16
+			next[x+1] += e * 5 / 16
+			next[x+2] += e * 1 / 16
+		}
+		current, next = next, current
+		for i := range next {
+			next[i] = 0
+		}
+	}
+	return gray
+}
+
+// level returns the nearest of levels evenly spaced gray levels to v
+func level(v float64, levels int) uint8 {
+	step := 255 / float64(levels-1)
+	return clamp(math.Round(v/step) * step)
+}
+
+func clamp(v float64) uint8 {
+	switch {
+	case v < 0:
+		return 0
+	case v > 255:
+		return 255
+	}
+	return uint8(math.Round(v))
+}
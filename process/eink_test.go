@@ -0,0 +1,82 @@
+package process
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestQuantize(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 256, 1))
+	for x := 0; x < 256; x++ {
+		gray.SetGray(x, 0, color.Gray{uint8(x)})
+	}
+	levels := make(map[uint8]bool)
+	for _, v := range Quantize(gray, 16).Pix {
+		if v%17 != 0 {
+			t.Errorf("Got %d, not one of 16 levels", v)
+		}
+		levels[v] = true
+	}
+	if len(levels) != 16 {
+		t.Errorf("Got %d levels, expect 16", len(levels))
+	}
+}
+
+func TestDither(t *testing.T) {
+	/* a flat gray between two levels dithers to both, averaging the same */
+	gray := image.NewGray(image.Rect(0, 0, 64, 64))
+	for i := range gray.Pix {
+		gray.Pix[i] = 8
+	}
+	sum := 0
+	for _, v := range Dither(gray, 16).Pix {
+		if v != 0 && v != 17 {
+			t.Fatalf("Got %d, expect 0 or 17", v)
+		}
+		sum += int(v)
+	}
+	if mean := float64(sum) / float64(len(gray.Pix)); mean < 7.5 || mean > 8.5 {
+		t.Errorf("Got mean %f, expect 8", mean)
+	}
+}
+
+func TestQuantizeSubImage(t *testing.T) {
+	/* only the pixels of a sub-image change */
+	gray := image.NewGray(image.Rect(0, 0, 4, 2))
+	for i := range gray.Pix {
+		gray.Pix[i] = 100
+	}
+	Quantize(gray.SubImage(image.Rect(2, 0, 4, 2)).(*image.Gray), 2)
+	expect := []uint8{100, 100, 0, 0, 100, 100, 0, 0}
+	for i, v := range gray.Pix {
+		if v != expect[i] {
+			t.Fatalf("Got %v, expect %v", gray.Pix, expect)
+		}
+	}
+}
+
+func TestProfile(t *testing.T) {
+	profile, err := LookupProfile("kobo-libra")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LookupProfile("etch-a-sketch"); err == nil {
+		t.Error("unknown profile found")
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, 2528, 1680))
+	pages := []Page{{Image: img}}
+	for _, stage := range profile.Stages() {
+		if pages, err = stage.Process(pages); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gray, ok := pages[0].Image.(*image.Gray)
+	if !ok {
+		t.Fatalf("Got %T, expect a gray image", pages[0].Image)
+	}
+	if size := gray.Bounds().Size(); size != image.Pt(1264, 840) {
+		t.Errorf("Got size %v, expect 1264x840", size)
+	}
+}
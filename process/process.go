@@ -0,0 +1,151 @@
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"mangadl/imagetype"
+)
+
+// DefaultQuality is the JPEG quality when Output has none
+const DefaultQuality = 90
+
+// MaxJPEGSize is the largest width or height of a JPEG image. Taller pages,
+// such as a whole webtoon chapter, are encoded as PNG instead.
+const MaxJPEGSize = 65535
+
+// Page is a page going through the pipeline. Image is nil for a page that
+// cannot be decoded, which is then kept as it was downloaded. Data is the
+// page as downloaded, until a stage changes its image.
+type Page struct {
+	Image image.Image
+	Type  imagetype.Type
+	Data  []byte
+}
+
+// Stage is a step of the pipeline. It gets the pages of a whole chapter in
+// reading order, so that a stage may split or merge pages. Pages whose image
+// a stage changes or makes must have no Data.
+type Stage interface {
+	Process(pages []Page) ([]Page, error)
+}
+
+// Each is a Stage applying a function to every decoded page. The function
+// returns its image when it leaves it as it is, and a new image otherwise.
+type Each func(img image.Image) image.Image
+
+// Process applies f to the image of every page
+func (f Each) Process(pages []Page) ([]Page, error) {
+	for i := range pages {
+		if pages[i].Image == nil {
+			continue
+		}
+		if img := f(pages[i].Image); img != pages[i].Image {
+			pages[i].Image = img
+			pages[i].Data = nil
+		}
+	}
+	return pages, nil
+}
+
+// Output is the encoding of the processed pages
+type Output struct {
+	// Format is jpeg or png, or empty to keep JPEG and PNG pages in their
+	// type and turn the other types to PNG. Pages too large for JPEG are PNG.
+	Format string
+	// Quality is the JPEG quality from 1 to 100, DefaultQuality if 0. Without
+	// Format and Quality, JPEG and PNG pages no stage changed are kept as
+	// downloaded rather than encoded again.
+	Quality int
+}
+
+// Pipeline processes the pages of a chapter between their download and the
+// archive. A nil *Pipeline leaves the pages as they are.
+type Pipeline struct {
+	Stages []Stage
+	Output Output
+}
+
+// ParseFormat checks an output format given on the command line
+func ParseFormat(format string) (string, error) {
+	switch format {
+	case "", imagetype.JPEG.Name, imagetype.PNG.Name:
+		return format, nil
+	case "jpg":
+		return imagetype.JPEG.Name, nil
+	}
+	return "", fmt.Errorf("unknown format %q, need jpeg or png", format)
+}
+
+// Process decodes the pages of a chapter, runs them through the stages and
+// encodes them again
+func (p *Pipeline) Process(pages [][]byte) ([][]byte, error) {
+	if p == nil {
+		return pages, nil
+	}
+
+	decoded := make([]Page, len(pages))
+	for i, data := range pages {
+		img, t, err := imagetype.Decode(data)
+		if err != nil {
+			log.Printf("Page %d kept as is: %v", i, err)
+			img = nil
+		}
+		decoded[i] = Page{Image: img, Type: t, Data: data}
+	}
+
+	var err error
+	for _, stage := range p.Stages {
+		if decoded, err = stage.Process(decoded); err != nil {
+			return nil, err
+		}
+	}
+
+	encoded := make([][]byte, len(decoded))
+	for i, page := range decoded {
+		if encoded[i], err = p.Output.encode(page); err != nil {
+			return nil, fmt.Errorf("page %d: %v", i, err)
+		}
+	}
+	return encoded, nil
+}
+
+func (o Output) encode(page Page) ([]byte, error) {
+	if page.Image == nil {
+		return page.Data, nil
+	}
+	if page.Data != nil && o.Format == "" && o.Quality == 0 && (page.Type == imagetype.JPEG || page.Type == imagetype.PNG) {
+		return page.Data, nil
+	}
+
+	format := o.Format
+	if format == "" {
+		format = imagetype.PNG.Name
+		if page.Type == imagetype.JPEG {
+			format = imagetype.JPEG.Name
+		}
+	}
+
+	if b := page.Image.Bounds(); format == imagetype.JPEG.Name && (b.Dx() > MaxJPEGSize || b.Dy() > MaxJPEGSize) {
+		format = imagetype.PNG.Name
+	}
+
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case imagetype.JPEG.Name:
+		quality := o.Quality
+		if quality == 0 {
+			quality = DefaultQuality
+		}
+		err = jpeg.Encode(&buf, page.Image, &jpeg.Options{Quality: quality})
+	case imagetype.PNG.Name:
+		err = png.Encode(&buf, page.Image)
+	default:
+		err = fmt.Errorf("unknown format %q", format)
+	}
+	return buf.Bytes(), err
+}
@@ -0,0 +1,124 @@
+package process
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"mangadl/imagetype"
+	"testing"
+)
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T, width, height int) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestFit(t *testing.T) {
+	cases := []struct {
+		w, h, maxW, maxH int
+		expect           image.Point
+	}{
+		{100, 200, 0, 0, image.Pt(100, 200)},
+		{100, 200, 50, 0, image.Pt(50, 100)},
+		{100, 200, 0, 50, image.Pt(25, 50)},
+		{100, 200, 80, 80, image.Pt(40, 80)},
+		{100, 200, 200, 400, image.Pt(100, 200)},
+		{1000, 1, 10, 0, image.Pt(10, 1)},
+	}
+	for _, c := range cases {
+		got := Fit(image.NewRGBA(image.Rect(0, 0, c.w, c.h)), c.maxW, c.maxH).Bounds().Size()
+		if got != c.expect {
+			t.Errorf("%dx%d in %dx%d: got %v, expect %v", c.w, c.h, c.maxW, c.maxH, got, c.expect)
+		}
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	pages := [][]byte{encodeJPEG(t, 100, 200), encodePNG(t, 100, 200), []byte("not an image")}
+
+	var nilPipeline *Pipeline
+	if got, err := nilPipeline.Process(pages); err != nil || len(got) != 3 || !bytes.Equal(got[0], pages[0]) {
+		t.Error("nil pipeline changed the pages")
+	}
+
+	/* pages keep their type by default, and undecodable pages are kept */
+	p := &Pipeline{Stages: []Stage{MaxSize(50, 0)}}
+	got, err := p.Process(pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, expect := range []imagetype.Type{imagetype.JPEG, imagetype.PNG} {
+		img, typ, err := imagetype.Decode(got[i])
+		if err != nil || typ != expect || img.Bounds().Size() != image.Pt(50, 100) {
+			t.Errorf("Page %d: got %s %v, %v", i, typ.Name, img.Bounds().Size(), err)
+		}
+	}
+	if !bytes.Equal(got[2], pages[2]) {
+		t.Error("undecodable page changed")
+	}
+
+	/* pages no stage changed are kept as downloaded */
+	p = &Pipeline{Stages: []Stage{MaxSize(200, 0)}}
+	got, err = p.Process(pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range got {
+		if !bytes.Equal(got[i], pages[i]) {
+			t.Errorf("Page %d encoded again", i)
+		}
+	}
+	p = &Pipeline{Output: Output{Quality: 50}}
+	if got, err = p.Process(pages[:1]); err != nil || bytes.Equal(got[0], pages[0]) {
+		t.Errorf("Got %v, expect the page encoded at quality 50", err)
+	}
+
+	/* even in place changes of a gray page */
+	var gray bytes.Buffer
+	img := image.NewGray(image.Rect(0, 0, 100, 200))
+	for i := range img.Pix {
+		img.Pix[i] = 128
+	}
+	if err := png.Encode(&gray, img); err != nil {
+		t.Fatal(err)
+	}
+	p = &Pipeline{Stages: Profiles["kindle"].Stages()}
+	if got, err = p.Process([][]byte{gray.Bytes()}); err != nil || bytes.Equal(got[0], gray.Bytes()) {
+		t.Errorf("Got %v, expect the gray page processed", err)
+	}
+
+	/* or are converted */
+	p = &Pipeline{Output: Output{Format: "jpeg", Quality: 50}}
+	got, err = p.Process(pages[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range got {
+		if typ, _ := imagetype.Sniff(got[i]); typ != imagetype.JPEG {
+			t.Errorf("Page %d: got %s, expect jpeg", i, typ.Name)
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for format, expect := range map[string]string{"": "", "jpeg": "jpeg", "jpg": "jpeg", "png": "png"} {
+		if got, err := ParseFormat(format); err != nil || got != expect {
+			t.Errorf("%q: got %q, %v", format, got, err)
+		}
+	}
+	if _, err := ParseFormat("bmp"); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
@@ -0,0 +1,57 @@
+package process
+
+import (
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// Fit scales an image down to fit in width x height, keeping its aspect
+// ratio. A zero width or height does not limit that dimension. Images which
+// already fit are returned as they are.
+func Fit(img image.Image, width, height int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	scale := 1.0
+	if width > 0 && w > width {
+		scale = float64(width) / float64(w)
+	}
+	if height > 0 && h > height && float64(height)/float64(h) < scale {
+		scale = float64(height) / float64(h)
+	}
+	if scale == 1 {
+		return img
+	}
+	return Resize(img, scaled(w, scale), scaled(h, scale))
+}
+
+// scaled returns a dimension scaled down, at least 1 pixel
+func scaled(n int, scale float64) int {
+	if s := int(float64(n)*scale + 0.5); s > 1 {
+		return s
+	}
+	return 1
+}
+
+// Resize scales an image to width x height
+func Resize(img image.Image, width, height int) image.Image {
+	dst := newLike(img, image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return dst
+}
+
+// newLike returns an empty image of the bounds, gray for a gray image so
+// that grayscale pages stay small once encoded
+func newLike(img image.Image, bounds image.Rectangle) draw.Image {
+	if _, ok := img.(*image.Gray); ok {
+		return image.NewGray(bounds)
+	}
+	return image.NewRGBA(bounds)
+}
+
+// MaxSize is a Stage scaling pages down to fit in Width x Height
+func MaxSize(width, height int) Stage {
+	return Each(func(img image.Image) image.Image {
+		return Fit(img, width, height)
+	})
+}
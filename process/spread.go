@@ -0,0 +1,85 @@
+package process
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+)
+
+// SpreadRatio is the width to height ratio above which a page is taken for a
+// double-page spread
+const SpreadRatio = 1.0
+
+// Reading orders of the halves of a spread
+const (
+	RightToLeft = "rtl"
+	LeftToRight = "ltr"
+)
+
+// ParseOrder checks a reading order given on the command line
+func ParseOrder(order string) (string, error) {
+	switch order {
+	case "", RightToLeft, LeftToRight:
+		return order, nil
+	}
+	return "", fmt.Errorf("unknown reading order %q, need rtl or ltr", order)
+}
+
+// SplitSpreads is a Stage splitting double-page spreads into two pages, the
+// right half first for order RightToLeft as in manga, the left half first
+// for LeftToRight
+func SplitSpreads(order string) Stage {
+	return spreadSplitter{order}
+}
+
+type spreadSplitter struct {
+	order string
+}
+
+func (s spreadSplitter) Process(pages []Page) ([]Page, error) {
+	var split []Page
+	for _, page := range pages {
+		if page.Image == nil || !IsSpread(page.Image) {
+			split = append(split, page)
+			continue
+		}
+
+		left, right := halves(page.Image)
+		first, second := left, right
+		if s.order == RightToLeft {
+			first, second = right, left
+		}
+		split = append(split, Page{Image: first, Type: page.Type}, Page{Image: second, Type: page.Type})
+	}
+	return split, nil
+}
+
+// IsSpread reports whether an image is a double-page spread, from its
+// aspect ratio
+func IsSpread(img image.Image) bool {
+	size := img.Bounds().Size()
+	return size.Y > 0 && float64(size.X)/float64(size.Y) > SpreadRatio
+}
+
+type subImager interface {
+	SubImage(r image.Rectangle) image.Image
+}
+
+// halves returns the left and right halves of an image
+func halves(img image.Image) (image.Image, image.Image) {
+	b := img.Bounds()
+	middle := b.Min.X + b.Dx()/2
+	left := image.Rect(b.Min.X, b.Min.Y, middle, b.Max.Y)
+	right := image.Rect(middle, b.Min.Y, b.Max.X, b.Max.Y)
+	return crop(img, left), crop(img, right)
+}
+
+// crop returns the part r of an image, sharing its pixels when it can
+func crop(img image.Image, r image.Rectangle) image.Image {
+	if sub, ok := img.(subImager); ok {
+		return sub.SubImage(r)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, r.Min, draw.Src)
+	return dst
+}
@@ -0,0 +1,42 @@
+package process
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestSplitSpreads(t *testing.T) {
+	/* a spread with a black left half and a white right half */
+	spread := image.NewGray(image.Rect(0, 0, 200, 150))
+	for y := 0; y < 150; y++ {
+		for x := 100; x < 200; x++ {
+			spread.SetGray(x, y, color.Gray{255})
+		}
+	}
+	single := image.NewGray(image.Rect(0, 0, 100, 150))
+	pages := []Page{{Image: single}, {Image: spread}, {Data: []byte("undecodable")}}
+
+	for order, expect := range map[string][]uint8{RightToLeft: {255, 0}, LeftToRight: {0, 255}} {
+		got, err := SplitSpreads(order).Process(append([]Page(nil), pages...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 4 {
+			t.Fatalf("%s: got %d pages, expect 4", order, len(got))
+		}
+		if got[0].Image != single || got[3].Data == nil {
+			t.Errorf("%s: other pages moved", order)
+		}
+		for i, value := range expect {
+			half := got[i+1].Image
+			if size := half.Bounds().Size(); size != image.Pt(100, 150) {
+				t.Errorf("%s: half %d is %v", order, i, size)
+			}
+			b := half.Bounds()
+			if c := color.GrayModel.Convert(half.At(b.Min.X, b.Min.Y)).(color.Gray); c.Y != value {
+				t.Errorf("%s: half %d is %d, expect %d", order, i, c.Y, value)
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package process
+
+import (
+	"image"
+)
+
+// Trim is a Stage cropping the uniform margins of scans off pages. A margin
+// is made of the rows or columns at an edge whose pixels are all within
+// tolerance of the gray of its corner. Trimming is skipped in a direction
+// where it would leave less than minSize of the page, from 0 to 1, so that
+// mostly blank pages are kept whole.
+func Trim(tolerance uint8, minSize float64) Stage {
+	return Each(func(img image.Image) image.Image {
+		r := Margins(img, tolerance)
+		b := img.Bounds()
+		if float64(r.Dx()) < minSize*float64(b.Dx()) {
+			r.Min.X, r.Max.X = b.Min.X, b.Max.X
+		}
+		if float64(r.Dy()) < minSize*float64(b.Dy()) {
+			r.Min.Y, r.Max.Y = b.Min.Y, b.Max.Y
+		}
+		if r.Empty() || r == b {
+			return img
+		}
+		return crop(img, r)
+	})
+}
+
+// Margins returns the bounds of an image without its uniform margins
+func Margins(img image.Image, tolerance uint8) image.Rectangle {
+	gray := Grayscale(img)
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return b
+	}
+	lines := rows(gray)
+
+	near := func(v, ref uint8) bool {
+		if v > ref {
+			return v-ref <= tolerance
+		}
+		return ref-v <= tolerance
+	}
+	blankRow := func(y int, ref uint8) bool {
+		for _, v := range lines[y] {
+			if !near(v, ref) {
+				return false
+			}
+		}
+		return true
+	}
+	blankColumn := func(x, top, bottom int, ref uint8) bool {
+		for y := top; y < bottom; y++ {
+			if !near(lines[y][x], ref) {
+				return false
+			}
+		}
+		return true
+	}
+
+	/* margins are compared with the top left and bottom right corners */
+	first, last := lines[0][0], lines[h-1][w-1]
+	top, bottom := 0, h
+	for top < bottom && blankRow(top, first) {
+		top++
+	}
+	for bottom > top && blankRow(bottom-1, last) {
+		bottom--
+	}
+	if top == bottom {
+		/* a blank page has no content to keep */
+		return image.Rectangle{Min: b.Min, Max: b.Min}
+	}
+	left, right := 0, w
+	for left < right && blankColumn(left, top, bottom, first) {
+		left++
+	}
+	for right > left && blankColumn(right-1, top, bottom, last) {
+		right--
+	}
+	return image.Rect(left, top, right, bottom).Add(b.Min)
+}
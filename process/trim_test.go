@@ -0,0 +1,63 @@
+package process
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// scan returns a white page of 100x200 with a noisy gray block of content
+func scan(content image.Rectangle) *image.Gray {
+	gray := image.NewGray(image.Rect(0, 0, 100, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 100; x++ {
+			gray.SetGray(x, y, color.Gray{250 + uint8((x*7+y*3)%5)})
+		}
+	}
+	for y := content.Min.Y; y < content.Max.Y; y++ {
+		for x := content.Min.X; x < content.Max.X; x++ {
+			gray.SetGray(x, y, color.Gray{uint8(x * y % 200)})
+		}
+	}
+	return gray
+}
+
+func TestMargins(t *testing.T) {
+	content := image.Rect(10, 20, 90, 150)
+	if got := Margins(scan(content), 8); got != content {
+		t.Errorf("Got %v, expect %v", got, content)
+	}
+
+	/* noise beyond the tolerance is content */
+	if got := Margins(scan(content), 2); got != image.Rect(0, 0, 100, 200) {
+		t.Errorf("Got %v with a low tolerance, expect the whole page", got)
+	}
+
+	/* a sub-image keeps its coordinates */
+	sub := scan(content).SubImage(image.Rect(5, 5, 95, 195))
+	if got := Margins(sub, 8); got != content {
+		t.Errorf("Got %v for a sub-image, expect %v", got, content)
+	}
+}
+
+func TestTrim(t *testing.T) {
+	pages := []Page{
+		{Image: scan(image.Rect(10, 20, 90, 150))},
+		{Image: scan(image.Rect(40, 90, 60, 110))},
+		{Image: scan(image.Rectangle{})}}
+	got, err := Trim(8, 0.5).Process(pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []image.Point{
+		image.Pt(80, 130),
+		/* not trimmed below half the page */
+		image.Pt(100, 200),
+		/* blank pages are kept */
+		image.Pt(100, 200)}
+	for i, size := range expect {
+		if got := got[i].Image.Bounds().Size(); got != size {
+			t.Errorf("Page %d: got %v, expect %v", i, got, size)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package process
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"mangadl/imagetype"
+)
+
+// GutterTolerance is the gray difference within a row still taken for a
+// gutter, as scans and compression are rarely perfectly uniform
+const GutterTolerance = 16
+
+// Webtoon is a Stage for long strip comics, whose pages are arbitrary slices
+// of one vertical strip. It stitches the pages of a chapter together and
+// slices the strip again into pages of at most height pixels, cut in the
+// gutters between panels: rows within tolerance of a uniform gray. A strip
+// without a gutter in the lower half of a page is cut at height. With height
+// 0 the whole strip is a single tall page. Pages which cannot be decoded
+// break the strip.
+func Webtoon(height int, tolerance uint8) Stage {
+	return webtoon{height, tolerance}
+}
+
+type webtoon struct {
+	height    int
+	tolerance uint8
+}
+
+func (w webtoon) Process(pages []Page) ([]Page, error) {
+	var sliced []Page
+	var strip []Page
+	flush := func() {
+		if len(strip) > 0 {
+			sliced = append(sliced, w.slice(newStrip(strip))...)
+			strip = nil
+		}
+	}
+	for _, page := range pages {
+		if page.Image == nil {
+			flush()
+			sliced = append(sliced, page)
+			continue
+		}
+		strip = append(strip, page)
+	}
+	flush()
+	return sliced, nil
+}
+
+// strip is pages stacked vertically, scaled to the same width, without
+// copying them into one image
+type strip struct {
+	pages   []image.Image
+	offsets []int // top of every page in the strip
+	width   int
+	height  int
+	typ     imagetype.Type
+}
+
+func newStrip(pages []Page) *strip {
+	s := &strip{typ: pages[0].Type}
+	for _, page := range pages {
+		if w := page.Image.Bounds().Dx(); w > s.width {
+			s.width = w
+		}
+	}
+	for _, page := range pages {
+		img := page.Image
+		b := img.Bounds()
+		if b.Dx() != s.width && b.Dx() > 0 {
+			img = Resize(img, s.width, scaled(b.Dy(), float64(s.width)/float64(b.Dx())))
+		}
+		s.pages = append(s.pages, img)
+		s.offsets = append(s.offsets, s.height)
+		s.height += img.Bounds().Dy()
+	}
+	return s
+}
+
+// row returns the page and its row at the row y of the strip
+func (s *strip) row(y int) (image.Image, int) {
+	i := len(s.offsets) - 1
+	for i > 0 && s.offsets[i] > y {
+		i--
+	}
+	img := s.pages[i]
+	return img, img.Bounds().Min.Y + y - s.offsets[i]
+}
+
+// blank reports whether the row y of the strip is a gutter
+func (s *strip) blank(y int, tolerance uint8) bool {
+	img, row := s.row(y)
+	b := img.Bounds()
+	first := color.GrayModel.Convert(img.At(b.Min.X, row)).(color.Gray).Y
+	for x := b.Min.X + 1; x < b.Max.X; x++ {
+		v := color.GrayModel.Convert(img.At(x, row)).(color.Gray).Y
+		if v > first && v-first > tolerance || first > v && first-v > tolerance {
+			return false
+		}
+	}
+	return true
+}
+
+// draw copies the rows from top to bottom of the strip into a new image
+func (s *strip) draw(top, bottom int) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, s.width, bottom-top))
+	for i, img := range s.pages {
+		start, end := s.offsets[i], s.offsets[i]+img.Bounds().Dy()
+		if end <= top || start >= bottom {
+			continue
+		}
+		/* the part of the page between top and bottom */
+		from, to := start, end
+		if from < top {
+			from = top
+		}
+		if to > bottom {
+			to = bottom
+		}
+		r := image.Rect(0, from-top, s.width, to-top)
+		draw.Draw(dst, r, img, img.Bounds().Min.Add(image.Pt(0, from-start)), draw.Src)
+	}
+	return dst
+}
+
+func (w webtoon) slice(s *strip) []Page {
+	if w.height <= 0 || s.height <= w.height {
+		return []Page{{Image: s.draw(0, s.height), Type: s.typ}}
+	}
+
+	var pages []Page
+	for top := 0; top < s.height; {
+		bottom := top + w.height
+		if bottom >= s.height {
+			bottom = s.height
+		} else {
+			/* cut at the lowest gutter in the lower half of the page */
+			for y := bottom - 1; y > top+w.height/2; y-- {
+				if s.blank(y, w.tolerance) {
+					bottom = y + 1
+					break
+				}
+			}
+		}
+		pages = append(pages, Page{Image: s.draw(top, bottom), Type: s.typ})
+		top = bottom
+	}
+	return pages
+}
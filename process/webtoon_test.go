@@ -0,0 +1,87 @@
+package process
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"mangadl/imagetype"
+	"testing"
+)
+
+// panels returns a white slice of a strip, width x height, with panels of
+// black and white columns on the rows from top to bottom
+func panels(width, height int, rows ...[2]int) *image.Gray {
+	gray := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range gray.Pix {
+		gray.Pix[i] = 255
+	}
+	for _, r := range rows {
+		for y := r[0]; y < r[1]; y++ {
+			for x := 0; x < width; x += 2 {
+				gray.SetGray(x, y, color.Gray{0})
+			}
+		}
+	}
+	return gray
+}
+
+func TestWebtoon(t *testing.T) {
+	/* a strip of 300 rows with gutters at 100-120 and 220-240, cut across panels */
+	pages := []Page{
+		{Image: panels(100, 150, [2]int{0, 100}, [2]int{120, 150})},
+		{Image: panels(100, 150, [2]int{0, 70}, [2]int{90, 150})}}
+
+	got, err := Webtoon(130, 8).Process(pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []int{120, 120, 60}
+	if len(got) != len(expect) {
+		t.Fatalf("Got %d pages, expect %d", len(got), len(expect))
+	}
+	for i, height := range expect {
+		if h := got[i].Image.Bounds().Dy(); h != height {
+			t.Errorf("Page %d: got height %d, expect %d", i, h, height)
+		}
+	}
+
+	/* a narrow slice is scaled to the strip */
+	got, _ = Webtoon(0, 8).Process([]Page{pages[0], {Image: panels(50, 75, [2]int{0, 35}, [2]int{45, 75})}})
+	if len(got) != 1 || got[0].Image.Bounds().Size() != image.Pt(100, 300) {
+		t.Fatalf("Got %d pages, expect one page of 100x300", len(got))
+	}
+	if c := color.GrayModel.Convert(got[0].Image.At(50, 230)).(color.Gray); c.Y != 255 {
+		t.Errorf("Got %d in the gutter of the scaled slice, expect white", c.Y)
+	}
+
+	/* without gutters, pages are cut at the height */
+	got, _ = Webtoon(100, 8).Process([]Page{{Image: panels(10, 250, [2]int{0, 250})}})
+	if len(got) != 3 || got[0].Image.Bounds().Dy() != 100 || got[2].Image.Bounds().Dy() != 50 {
+		t.Errorf("Got %d pages without gutters, expect 100, 100 and 50 rows", len(got))
+	}
+}
+
+func TestWebtoonTallStrip(t *testing.T) {
+	/* a chapter taller than JPEG allows, as a single page */
+	var pages [][]byte
+	for i := 0; i < 3; i++ {
+		var buf bytes.Buffer
+		jpeg.Encode(&buf, panels(4, 30000, [2]int{0, 100}), nil)
+		pages = append(pages, buf.Bytes())
+	}
+	p := &Pipeline{Stages: []Stage{Webtoon(0, GutterTolerance)}, Output: Output{Format: imagetype.JPEG.Name}}
+	got, err := p.Process(pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("Got %d pages, expect 1", len(got))
+	}
+	if typ, _ := imagetype.Sniff(got[0]); typ != imagetype.PNG {
+		t.Errorf("Got %s, expect png", typ.Name)
+	}
+	if _, h, _ := imagetype.Size(got[0]); h != 90000 {
+		t.Errorf("Got height %d, expect 90000", h)
+	}
+}
@@ -0,0 +1,513 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mangadl/chapter"
+	"mangadl/comicinfo"
+	"mangadl/epub"
+	"mangadl/pdf"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Output formats of the downloaded pages
+const (
+	outputCBZ  = "cbz"
+	outputCBT  = "cbt"
+	outputEPUB = "epub"
+	outputPDF  = "pdf"
+	outputDir  = "dir"
+)
+
+// Sink is the output of downloaded pages, an archive or a directory
+type Sink interface {
+	// Add writes a page
+	Add(page DownloadResult) error
+	// Close completes the output once all its pages are added
+	Close() error
+}
+
+// newSink opens the output named name, the path of an archive or directory.
+// metadata is what is known of the series, nil if nothing.
+type newSink func(name string, metadata *Metadata) (Sink, error)
+
+// Output is how the downloaded pages are written
+type Output struct {
+	Format string
+	// Deterministic archives are the same bytes for the same pages: their
+	// entries, ComicInfo.xml included, are sorted by name, stored without
+	// compression, and dated by the release of their chapter. The pages of
+	// an archive are kept in memory until it is complete. Only cbz and cbt
+	// archives can be deterministic.
+	Deterministic bool
+}
+
+// epoch is the date of the entries of a deterministic archive whose
+// chapter release is unknown, the earliest date of a zip entry
+var epoch = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// formats are the output formats
+var formats = []string{outputCBZ, outputCBT, outputEPUB, outputPDF, outputDir}
+
+// open is the newSink of the output
+func (o Output) open(name string, metadata *Metadata) (Sink, error) {
+	if o.Format == outputDir {
+		return newDirSink(name, metadata)
+	}
+
+	file, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	var s Sink
+	switch o.Format {
+	case outputCBZ:
+		s = newZipSink(file, metadata, o.Deterministic)
+	case outputCBT:
+		s = newTarSink(file, metadata, o.Deterministic)
+	case outputEPUB:
+		s, err = newEpubSink(file, metadata)
+	case outputPDF:
+		s, err = newPDFSink(file, metadata)
+	default:
+		err = fmt.Errorf("unknown output %q", o.Format)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return fileSink{s, file}, nil
+}
+
+// outputName returns the name of an archive with the extension of the output
+// format instead of .cbz, or without extension for a directory
+func outputName(name, output string) string {
+	name = strings.TrimSuffix(name, ".cbz")
+	if output == outputDir {
+		return name
+	}
+	return name + "." + output
+}
+
+// fileSink is a sink writing to a file, closed with the sink
+type fileSink struct {
+	Sink
+	file *os.File
+}
+
+func (f fileSink) Close() error {
+	err := f.Sink.Close()
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func createArchive(archiveName string, open newSink, downloadedPages <-chan DownloadResult, metadata *Metadata) error {
+	/* create the archive on its first page, none when every chapter failed */
+	first, ok := <-downloadedPages
+	if !ok {
+		log.Println("No pages, not creating:", archiveName)
+		return nil
+	}
+	sink, err := open(archiveName, metadata)
+	if err != nil {
+		drain(downloadedPages)
+		return err
+	}
+	log.Println("Creating archive:", archiveName)
+
+	/* write to the archive from result channel, and close it */
+	if err = sink.Add(first); err != nil {
+		drain(downloadedPages)
+		sink.Close()
+		return fmt.Errorf("%s: %v", archiveName, err)
+	}
+	if err = sinkChan(sink, downloadedPages); err != nil {
+		return fmt.Errorf("%s: %v", archiveName, err)
+	}
+	log.Printf("%s closed\n", archiveName)
+	return nil
+}
+
+// splitArchives writes the pages to the archive of their chapter. chapters
+// are the chapters to download, and finished receives every chapter once it
+// is done, downloaded or failed: an archive is completed as soon as all its
+// chapters are finished, instead of when the whole download is.
+func splitArchives(archiveName func(chapter.ID) string, open newSink, downloadedPages <-chan DownloadResult, chapters []chapter.ID, finished <-chan chapter.ID, metadata *Metadata) error {
+	/* the chapters still to finish of every archive */
+	remaining := make(map[string]int)
+	for _, c := range chapters {
+		remaining[archiveName(c)]++
+	}
+
+	/* one archive, and its own pages channel, per archive name */
+	archives := make(map[string]chan DownloadResult)
+	created := 0
+	errs := make(chan error)
+
+	for downloadedPages != nil || finished != nil {
+		select {
+		case page, ok := <-downloadedPages:
+			if !ok {
+				downloadedPages = nil
+				continue
+			}
+			/* send each page to the archive of its chapter, creating the archive on its first page */
+			name := archiveName(page.Chapter)
+			archive, found := archives[name]
+			if !found {
+				archive = make(chan DownloadResult)
+				archives[name] = archive
+				created++
+				go func() {
+					errs <- createArchive(name, open, archive, metadata)
+				}()
+			}
+			archive <- page
+
+		case c, ok := <-finished:
+			if !ok {
+				finished = nil
+				continue
+			}
+			/* all the pages of a finished chapter were sent before it finished */
+			name := archiveName(c)
+			remaining[name]--
+			if archive, found := archives[name]; found && remaining[name] <= 0 {
+				close(archive)
+				delete(archives, name)
+			}
+		}
+	}
+
+	/* close the archives left and wait until they are all written */
+	for _, archive := range archives {
+		close(archive)
+	}
+	var err error
+	for i := 0; i < created; i++ {
+		if archiveErr := <-errs; archiveErr != nil {
+			err = archiveErr
+		}
+	}
+	return err
+}
+
+// sinkChan writes the pages to a sink as each finished page arrives in the
+// channel, and closes the sink
+func sinkChan(sink Sink, downloadedPages <-chan DownloadResult) error {
+	for page := range downloadedPages {
+		if err := sink.Add(page); err != nil {
+			drain(downloadedPages)
+			sink.Close()
+			return err
+		}
+	}
+	return sink.Close()
+}
+
+// drain discards the remaining pages after a write error, so that the
+// download workers are not blocked forever
+func drain(downloadedPages <-chan DownloadResult) {
+	for range downloadedPages {
+	}
+}
+
+// chapterSet is the chapters of the pages added to a sink
+type chapterSet struct {
+	seen     map[chapter.ID]bool
+	chapters []chapter.ID
+}
+
+func (s *chapterSet) add(c chapter.ID) {
+	if s.seen == nil {
+		s.seen = make(map[chapter.ID]bool)
+	}
+	if !s.seen[c] {
+		s.seen[c] = true
+		s.chapters = append(s.chapters, c)
+	}
+}
+
+// sorted returns the chapters in reading order
+func (s *chapterSet) sorted() []chapter.ID {
+	chapter.Sort(s.chapters)
+	return s.chapters
+}
+
+// comicInfoPages collects the ComicInfo pages of an archive, unless its
+// metadata is nil
+type comicInfoPages struct {
+	metadata *Metadata
+	chapterSet
+	/* the pages by name, as readers sort them */
+	pages map[string]comicinfo.Page
+	names []string
+}
+
+func (c *comicInfoPages) add(page DownloadResult) {
+	if c.metadata == nil {
+		return
+	}
+	if c.pages == nil {
+		c.pages = make(map[string]comicinfo.Page)
+	}
+	c.pages[page.Name] = comicinfo.NewPage(page.Content)
+	c.names = append(c.names, page.Name)
+	c.chapterSet.add(page.Chapter)
+}
+
+// marshal returns the ComicInfo.xml of the pages, nil if the archive has no
+// metadata
+func (c *comicInfoPages) marshal() ([]byte, error) {
+	if c.metadata == nil {
+		return nil, nil
+	}
+	info := c.metadata.ComicInfo(c.sorted())
+	sort.Strings(c.names)
+	var sorted []comicinfo.Page
+	for _, name := range c.names {
+		sorted = append(sorted, c.pages[name])
+	}
+	info.SetPages(sorted)
+	return info.Marshal()
+}
+
+// entry is an entry of an archive, of chapters
+type entry struct {
+	name     string
+	content  []byte
+	chapters []chapter.ID
+}
+
+// archiveSink writes the pages to an archive entry by entry with create,
+// with their ComicInfo.xml unless metadata is nil. A deterministic archive
+// keeps its pages until it is closed, to write them sorted by name.
+type archiveSink struct {
+	create        func(entry) error
+	close         func() error
+	info          comicInfoPages
+	deterministic bool
+	pending       []entry
+}
+
+func (a *archiveSink) Add(page DownloadResult) error {
+	a.info.add(page)
+	e := entry{page.Name, page.Content, []chapter.ID{page.Chapter}}
+	if a.deterministic {
+		/* written in order of name once all the pages are known */
+		a.pending = append(a.pending, e)
+		return nil
+	}
+	return a.create(e)
+}
+
+// Close writes the pages kept and the ComicInfo.xml, after the pages as it
+// counts them, and closes the archive
+func (a *archiveSink) Close() error {
+	data, err := a.info.marshal()
+	if err != nil {
+		return err
+	}
+	entries := a.pending
+	if data != nil {
+		entries = append(entries, entry{comicinfo.FileName, data, a.info.chapters})
+	}
+	if a.deterministic {
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].name < entries[j].name
+		})
+	}
+	for _, e := range entries {
+		if err := a.create(e); err != nil {
+			return err
+		}
+	}
+	return a.close()
+}
+
+// zipWriter writes the entries of a zip archive, a CBZ
+type zipWriter struct {
+	zip           *zip.Writer
+	metadata      *Metadata
+	deterministic bool
+}
+
+func newZipSink(w io.Writer, metadata *Metadata, deterministic bool) Sink {
+	z := &zipWriter{zip.NewWriter(w), metadata, deterministic}
+	return &archiveSink{create: z.create, close: z.zip.Close, info: comicInfoPages{metadata: metadata}, deterministic: deterministic}
+}
+
+// create writes an entry of the archive
+func (z *zipWriter) create(e entry) error {
+	/* create zip writer with header of filename, DEFLATE method, and current time */
+	header := zip.FileHeader{
+		Name:   e.name,
+		Method: zip.Deflate}
+	header.SetModTime(time.Now())
+	if z.deterministic {
+		/* the images are compressed already, and stored entries do not
+		depend on the version of the compressor */
+		header.Method = zip.Store
+		header.SetModTime(z.metadata.Released(e.chapters))
+	}
+	f, err := z.zip.CreateHeader(&header)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(e.content)
+	return err
+}
+
+// tarWriter writes the entries of a tar archive, a CBT
+type tarWriter struct {
+	tar           *tar.Writer
+	metadata      *Metadata
+	deterministic bool
+}
+
+func newTarSink(w io.Writer, metadata *Metadata, deterministic bool) Sink {
+	t := &tarWriter{tar.NewWriter(w), metadata, deterministic}
+	return &archiveSink{create: t.create, close: t.tar.Close, info: comicInfoPages{metadata: metadata}, deterministic: deterministic}
+}
+
+// create writes an entry of the archive
+func (t *tarWriter) create(e entry) error {
+	header := tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     e.name,
+		Mode:     0644,
+		Size:     int64(len(e.content)),
+		ModTime:  time.Now()}
+	if t.deterministic {
+		header.ModTime = t.metadata.Released(e.chapters)
+	}
+	if err := t.tar.WriteHeader(&header); err != nil {
+		return err
+	}
+	_, err := t.tar.Write(e.content)
+	return err
+}
+
+// epubSink writes the pages to a fixed layout EPUB book, one page per image
+// with an entry per chapter in the table of contents
+type epubSink struct {
+	book     *epub.Writer
+	metadata *Metadata
+	chapterSet
+}
+
+func newEpubSink(w io.Writer, metadata *Metadata) (Sink, error) {
+	if metadata == nil {
+		metadata = &Metadata{}
+	}
+	book, err := epub.NewWriter(w, epub.Metadata{})
+	if err != nil {
+		return nil, err
+	}
+	return &epubSink{book: book, metadata: metadata}, nil
+}
+
+func (e *epubSink) Add(page DownloadResult) error {
+	if err := e.book.AddPage(page.Name, e.metadata.ChapterTitle(page.Chapter), page.Content); err != nil {
+		return err
+	}
+	e.add(page.Chapter)
+	return nil
+}
+
+func (e *epubSink) Close() error {
+	/* the book is named after the chapters it holds, known once they are all written */
+	chapters := e.sorted()
+	info := e.metadata.ComicInfo(chapters)
+	e.book.Metadata.Title = e.metadata.BookTitle(chapters)
+	e.book.Metadata.Language = info.LanguageISO
+	e.book.Metadata.Description = info.Summary
+	e.book.Metadata.RightToLeft = e.metadata.Info.RightToLeft
+	/* the same chapters of a series are the same book, downloaded again */
+	e.book.Metadata.Identifier = epub.UUID(fmt.Sprintf("%s %s %v", e.metadata.URL, e.metadata.Manga, chapters))
+	if e.metadata.Series != nil {
+		e.book.Metadata.Authors = e.metadata.Series.Authors
+	}
+	return e.book.Close()
+}
+
+// pdfSink writes the pages to a PDF document, one page per image with an
+// outline entry per chapter
+type pdfSink struct {
+	doc      *pdf.Writer
+	metadata *Metadata
+	chapterSet
+}
+
+func newPDFSink(w io.Writer, metadata *Metadata) (Sink, error) {
+	if metadata == nil {
+		metadata = &Metadata{}
+	}
+	doc, err := pdf.NewWriter(w, pdf.Metadata{RightToLeft: metadata.Info.RightToLeft})
+	if err != nil {
+		return nil, err
+	}
+	return &pdfSink{doc: doc, metadata: metadata}, nil
+}
+
+func (p *pdfSink) Add(page DownloadResult) error {
+	err := p.doc.AddPage(page.Name, p.metadata.ChapterTitle(page.Chapter), page.Content)
+	if errors.Is(err, pdf.ErrImage) {
+		/* a page missing is better than the rest of the document */
+		log.Println("Skipping page:", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	p.add(page.Chapter)
+	return nil
+}
+
+func (p *pdfSink) Close() error {
+	chapters := p.sorted()
+	p.doc.Metadata.Title = p.metadata.BookTitle(chapters)
+	p.doc.Metadata.Description = p.metadata.ComicInfo(chapters).Summary
+	if p.metadata.Series != nil {
+		p.doc.Metadata.Authors = p.metadata.Series.Authors
+	}
+	return p.doc.Close()
+}
+
+// dirSink writes the pages to files in a directory per chapter, e.g.
+// naruto/001/001.jpg, for other tools to process
+type dirSink struct {
+	dir string
+}
+
+func newDirSink(name string, metadata *Metadata) (Sink, error) {
+	if err := os.MkdirAll(name, 0755); err != nil {
+		return nil, err
+	}
+	return dirSink{name}, nil
+}
+
+func (d dirSink) Add(page DownloadResult) error {
+	dir := filepath.Join(d.dir, page.Chapter.Pad(3))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	/* the page number of the page name, image-001-003.jpg is 003.jpg */
+	name := strings.TrimPrefix(page.Name, fmt.Sprintf("image-%s-", page.Chapter.Pad(3)))
+	return ioutil.WriteFile(filepath.Join(dir, name), page.Content, 0644)
+}
+
+func (d dirSink) Close() error {
+	return nil
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mangadl/chapter"
+	"mangadl/epub"
+	"mangadl/site"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestZipSink(t *testing.T) {
+	/* test using buffer instead of file */
+	var buf bytes.Buffer
+
+	/* expected result */
+	expect := []DownloadResult{
+		DownloadResult{
+			Name:    "image-001-001.jpg",
+			Content: imageBuffer.Bytes()},
+		DownloadResult{
+			Name:    "image-001-002.jpg",
+			Content: imageBuffer.Bytes()},
+		DownloadResult{
+			Name:    "image-002-001.jpg",
+			Content: imageBuffer.Bytes()}}
+
+	/* create, fill, and close results channel */
+	downloadedPages := make(chan DownloadResult, 3)
+	for _, res := range expect {
+		downloadedPages <- res
+	}
+	close(downloadedPages)
+
+	/* TEST */
+	sink := newZipSink(&buf, nil, false)
+	if err := sinkChan(sink, downloadedPages); err != nil {
+		t.Fatal(err)
+	}
+
+	/* read the result zip archive */
+	got := zipReader(buf.Bytes())
+
+	/* got == expect ? */
+	if !reflect.DeepEqual(expect, got) {
+		fmt.Printf("Got: %s\n", got)
+		fmt.Printf("Expect: %s\n", expect)
+		t.Fail()
+	}
+}
+
+func TestSplitArchives(t *testing.T) {
+	dir := t.TempDir()
+	pages := []DownloadResult{
+		{Chapter: "1", Name: "image-001-001.jpg", Content: imageBuffer.Bytes()},
+		{Chapter: "2", Name: "image-002-001.jpg", Content: imageBuffer.Bytes()},
+		{Chapter: "1", Name: "image-001-002.jpg", Content: imageBuffer.Bytes()}}
+
+	/* create, fill, and close results channel */
+	downloadedPages := make(chan DownloadResult, len(pages))
+	for _, page := range pages {
+		downloadedPages <- page
+	}
+	close(downloadedPages)
+
+	metadata := &Metadata{Manga: "manga", Info: site.Info{RightToLeft: true}}
+	err := splitArchives(func(c chapter.ID) string {
+		return filepath.Join(dir, string(c)+".cbz")
+	}, Output{Format: outputCBZ}.open, downloadedPages, nil, nil, metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/* each chapter is in its own archive, with its metadata */
+	for c, expectNames := range map[string][]string{
+		"1": {"image-001-001.jpg", "image-001-002.jpg", "ComicInfo.xml"},
+		"2": {"image-002-001.jpg", "ComicInfo.xml"}} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, c+".cbz"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		var info string
+		for _, res := range zipReader(b) {
+			names = append(names, res.Name)
+			if res.Name == "ComicInfo.xml" {
+				info = string(res.Content)
+			}
+		}
+		if !reflect.DeepEqual(expectNames, names) {
+			t.Errorf("Chapter %s, got: %v, expect: %v", c, names, expectNames)
+		}
+		for _, expect := range []string{
+			"<Number>" + c + "</Number>",
+			fmt.Sprintf("<PageCount>%d</PageCount>", len(expectNames)-1),
+			`ImageWidth="10" ImageHeight="10"`,
+			"<Manga>YesAndRightToLeft</Manga>"} {
+			if !strings.Contains(info, expect) {
+				t.Errorf("Chapter %s, missing %s in ComicInfo:\n%s", c, expect, info)
+			}
+		}
+	}
+}
+
+func TestEpubSink(t *testing.T) {
+	downloadedPages := make(chan DownloadResult, 3)
+	downloadedPages <- DownloadResult{Chapter: "2", Name: "image-002-001.jpg", Content: imageBuffer.Bytes()}
+	downloadedPages <- DownloadResult{Chapter: "1", Name: "image-001-001.jpg", Content: imageBuffer.Bytes()}
+	downloadedPages <- DownloadResult{Chapter: "1", Name: "image-001-002.jpg", Content: imageBuffer.Bytes()}
+	close(downloadedPages)
+
+	metadata := &Metadata{
+		Manga: "naruto",
+		Info:  site.Info{Language: "en", RightToLeft: true},
+		URL:   "http://mangareader.net/naruto",
+		Series: &site.Series{
+			Title:    "Naruto",
+			Authors:  []string{"Kishimoto Masashi"},
+			Chapters: []site.Chapter{{ID: "1", Title: "Uzumaki Naruto"}}}}
+	var buf bytes.Buffer
+	sink, _ := newEpubSink(&buf, metadata)
+	if err := sinkChan(sink, downloadedPages); err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(map[string]string)
+	for _, res := range zipReader(buf.Bytes()) {
+		files[res.Name] = string(res.Content)
+	}
+	for name, expects := range map[string][]string{
+		"OEBPS/content.opf": {
+			`<dc:identifier id="book-id">` + epub.UUID("http://mangareader.net/naruto naruto [1 2]") + `</dc:identifier>`,
+			"<dc:title>Naruto Chapters 1-2</dc:title>",
+			"<dc:creator>Kishimoto Masashi</dc:creator>",
+			`<spine page-progression-direction="rtl">`},
+		"OEBPS/nav.xhtml": {
+			`<a href="pages/page-0001.xhtml">Chapter 1: Uzumaki Naruto</a>`,
+			`<a href="pages/page-0003.xhtml">Chapter 2</a>`}} {
+		for _, expect := range expects {
+			if !strings.Contains(files[name], expect) {
+				t.Errorf("Missing %s in %s:\n%s", expect, name, files[name])
+			}
+		}
+	}
+}
+
+func TestPDFSink(t *testing.T) {
+	downloadedPages := make(chan DownloadResult, 2)
+	downloadedPages <- DownloadResult{Chapter: "2", Name: "image-002-001.jpg", Content: imageBuffer.Bytes()}
+	downloadedPages <- DownloadResult{Chapter: "1", Name: "image-001-001.jpg", Content: imageBuffer.Bytes()}
+	close(downloadedPages)
+
+	metadata := &Metadata{
+		Manga: "naruto",
+		Series: &site.Series{
+			Title:    "Naruto",
+			Chapters: []site.Chapter{{ID: "1", Title: "Uzumaki Naruto"}}}}
+	var buf bytes.Buffer
+	sink, _ := newPDFSink(&buf, metadata)
+	if err := sinkChan(sink, downloadedPages); err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range []string{
+		"/Title (Naruto Chapters 1-2)",
+		"/Title (Chapter 1: Uzumaki Naruto) /Parent",
+		"/Title (Chapter 2) /Parent",
+		"/Filter /DCTDecode"} {
+		if !strings.Contains(buf.String(), expect) {
+			t.Errorf("Missing %s", expect)
+		}
+	}
+}
+
+func TestTarSink(t *testing.T) {
+	downloadedPages := make(chan DownloadResult, 2)
+	downloadedPages <- DownloadResult{Chapter: "1", Name: "image-001-002.jpg", Content: imageBuffer.Bytes()}
+	downloadedPages <- DownloadResult{Chapter: "1", Name: "image-001-001.jpg", Content: imageBuffer.Bytes()}
+	close(downloadedPages)
+
+	var buf bytes.Buffer
+	sink := newTarSink(&buf, &Metadata{Manga: "naruto"}, false)
+	if err := sinkChan(sink, downloadedPages); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	var info string
+	r := tar.NewReader(&buf)
+	for {
+		header, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+		content, _ := ioutil.ReadAll(r)
+		if header.Name == "ComicInfo.xml" {
+			info = string(content)
+		} else if !bytes.Equal(content, imageBuffer.Bytes()) {
+			t.Errorf("%s: content differs", header.Name)
+		}
+	}
+	if expect := []string{"image-001-002.jpg", "image-001-001.jpg", "ComicInfo.xml"}; !reflect.DeepEqual(names, expect) {
+		t.Errorf("Got: %v, expect: %v", names, expect)
+	}
+	if !strings.Contains(info, "<PageCount>2</PageCount>") {
+		t.Errorf("ComicInfo without its pages:\n%s", info)
+	}
+}
+
+func TestDirSink(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "naruto")
+	downloadedPages := make(chan DownloadResult, 3)
+	downloadedPages <- DownloadResult{Chapter: "1", Name: "image-001-000.jpg", Content: imageBuffer.Bytes()}
+	downloadedPages <- DownloadResult{Chapter: "10.5", Name: "image-010.5-001.png", Content: imageBuffer.Bytes()}
+	downloadedPages <- DownloadResult{Chapter: "1", Name: "image-001-001.jpg", Content: imageBuffer.Bytes()}
+	close(downloadedPages)
+
+	if err := createArchive(dir, Output{Format: outputDir}.open, downloadedPages, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"001/000.jpg", "001/001.jpg", "010.5/001.png"} {
+		content, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Error(err)
+		} else if !bytes.Equal(content, imageBuffer.Bytes()) {
+			t.Errorf("%s: content differs", name)
+		}
+	}
+}
+
+func TestCreateArchiveError(t *testing.T) {
+	/* the pages are drained so that the download does not block */
+	downloadedPages := make(chan DownloadResult, 2)
+	downloadedPages <- DownloadResult{Chapter: "1", Name: "image-001-000.jpg", Content: imageBuffer.Bytes()}
+	downloadedPages <- DownloadResult{Chapter: "1", Name: "image-001-001.jpg", Content: imageBuffer.Bytes()}
+	close(downloadedPages)
+
+	name := filepath.Join(t.TempDir(), "missing", "out.cbz")
+	if err := createArchive(name, Output{Format: outputCBZ}.open, downloadedPages, nil); err == nil {
+		t.Error("archive written in a missing directory")
+	}
+}
+
+func TestCreateArchiveEmpty(t *testing.T) {
+	downloadedPages := make(chan DownloadResult)
+	close(downloadedPages)
+
+	for _, format := range formats {
+		name := filepath.Join(t.TempDir(), "out."+format)
+		if err := createArchive(name, Output{Format: format}.open, downloadedPages, &Metadata{}); err != nil {
+			t.Errorf("%s: %v", format, err)
+		}
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s: archive without pages written", format)
+		}
+	}
+}
+
+func TestPDFSinkSkip(t *testing.T) {
+	/* pages which cannot be embedded, such as AVIF, are left out */
+	downloadedPages := make(chan DownloadResult, 2)
+	downloadedPages <- DownloadResult{Chapter: "1", Name: "image-001-000.avif", Content: []byte("\x00\x00\x00\x14ftypavif\x00\x00\x00\x00avif")}
+	downloadedPages <- DownloadResult{Chapter: "1", Name: "image-001-001.jpg", Content: imageBuffer.Bytes()}
+	close(downloadedPages)
+
+	name := filepath.Join(t.TempDir(), "out.pdf")
+	if err := createArchive(name, Output{Format: outputPDF}.open, downloadedPages, nil); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadFile(name)
+	if got := strings.Count(string(b), "/Type /Page "); got != 1 {
+		t.Errorf("Got %d pages, expect 1", got)
+	}
+}
+
+func TestOutputName(t *testing.T) {
+	for _, c := range []struct {
+		name, output, expect string
+	}{
+		{"dir/manga-001.cbz", outputEPUB, "dir/manga-001.epub"},
+		{"manga-001.cbz", outputCBT, "manga-001.cbt"},
+		{"manga-001.cbz", outputDir, "manga-001"},
+		{"one.piece", outputDir, "one.piece"},
+	} {
+		if got := outputName(c.name, c.output); got != c.expect {
+			t.Errorf("%s as %s, got: %s, expect: %s", c.name, c.output, got, c.expect)
+		}
+	}
+}
+
+func TestDeterministicCBZ(t *testing.T) {
+	released := time.Date(2009, 7, 5, 0, 0, 0, 0, time.UTC)
+	metadata := &Metadata{
+		Manga: "naruto",
+		Series: &site.Series{
+			Chapters: []site.Chapter{{ID: "1", Date: released}, {ID: "2"}}}}
+	pages := []DownloadResult{
+		{Chapter: "2", Name: "image-002-001.jpg", Content: imageBuffer.Bytes()},
+		{Chapter: "1", Name: "image-001-002.jpg", Content: imageBuffer.Bytes()},
+		{Chapter: "1", Name: "image-001-001.jpg", Content: imageBuffer.Bytes()}}
+
+	/* the same pages downloaded in another order */
+	dir := t.TempDir()
+	var archives [][]byte
+	for i, order := range [][]int{{0, 1, 2}, {2, 0, 1}} {
+		downloadedPages := make(chan DownloadResult, len(pages))
+		for _, n := range order {
+			downloadedPages <- pages[n]
+		}
+		close(downloadedPages)
+
+		name := filepath.Join(dir, fmt.Sprintf("%d.cbz", i))
+		if err := createArchive(name, Output{Format: outputCBZ, Deterministic: true}.open, downloadedPages, metadata); err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadFile(name)
+		archives = append(archives, b)
+	}
+	if !bytes.Equal(archives[0], archives[1]) {
+		t.Error("Archives of the same pages differ")
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(archives[0]), int64(len(archives[0])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+		if f.Method != zip.Store {
+			t.Errorf("%s: compressed", f.Name)
+		}
+		expect := released
+		if f.Name == "image-002-001.jpg" {
+			expect = epoch
+		}
+		if !f.Modified.Equal(expect) {
+			t.Errorf("%s: got date %v, expect %v", f.Name, f.Modified, expect)
+		}
+	}
+	if expect := []string{"ComicInfo.xml", "image-001-001.jpg", "image-001-002.jpg", "image-002-001.jpg"}; !reflect.DeepEqual(names, expect) {
+		t.Errorf("Got: %v, expect: %v", names, expect)
+	}
+}
+
+func TestSplitArchivesFinished(t *testing.T) {
+	dir := t.TempDir()
+	downloadedPages := make(chan DownloadResult)
+	finished := make(chan chapter.ID)
+	volumes := map[chapter.ID]string{"1": "1", "2": "1", "3": "2"}
+	name := func(c chapter.ID) string {
+		return filepath.Join(dir, "v"+volumes[c]+".cbz")
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- splitArchives(name, Output{Format: outputCBZ}.open, downloadedPages, []chapter.ID{"1", "2", "3"}, finished, nil)
+	}()
+
+	/* complete, for a reader, once the archive is written */
+	complete := func(file string) bool {
+		for i := 0; i < 100; i++ {
+			if _, err := zip.OpenReader(file); err == nil {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return false
+	}
+
+	downloadedPages <- DownloadResult{Chapter: "1", Name: "image-001-000.jpg", Content: imageBuffer.Bytes()}
+	finished <- "1"
+	downloadedPages <- DownloadResult{Chapter: "3", Name: "image-003-000.jpg", Content: imageBuffer.Bytes()}
+	finished <- "3"
+	if !complete(name("3")) {
+		t.Error("Archive of a finished volume not written")
+	}
+	if _, err := zip.OpenReader(name("1")); err == nil {
+		t.Error("Archive of a volume with a chapter left written")
+	}
+
+	/* a failed chapter finishes its volume too */
+	finished <- "2"
+	if !complete(name("1")) {
+		t.Error("Archive of a finished volume not written")
+	}
+	close(downloadedPages)
+	close(finished)
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,419 @@
+package site
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mangadl/chapter"
+	"mangadl/fetch"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"gopkg.in/yaml.v3"
+)
+
+// Definition is a site described by selectors and URL templates instead of
+// code, loaded from a YAML or JSON file. The URL templates are text/template
+// strings executed with URLData, e.g. for mangafox:
+//
+//	url: http://mangafox.me/manga/
+//	chapterURL: '{{.URL}}{{.Manga}}/c{{.Chapter.Pad 3}}/1.html'
+//	pageURL: '{{.URL}}{{.Manga}}/c{{.Chapter.Pad 3}}/{{.Value}}.html'
+//	image: '#image'
+//	pageList: 'select.m option'
+//	exclude: ['0']
+//	seriesURL: '{{.URL}}{{.Manga}}/'
+//	chapterList: 'ul.chlist li'
+//	chapterLink: 'a.tips'
+//	chapterTitle: 'span.title'
+//	chapterDate: 'span.date'
+//	dateLayout: 'Jan 2, 2006'
+//	volumePattern: '/v(\d+)/c'
+//	seriesAuthors: '#title a[href*="/author/"]'
+//	seriesGenres: '#title a[href*="/genres/"]'
+//	seriesSummary: '#title p.summary'
+//	language: en
+//	rightToLeft: true
+//
+// headers is an optional map of headers sent with every request to the site,
+// and rateLimit the optional rate of requests, e.g.
+//
+//	rateLimit: {rate: 2, burst: 4, minDelay: 100ms, jitter: 50ms}
+//
+// The series fields are optional; without them the site cannot list the
+// chapters of a series. volumePattern matches the volume of a chapter in the
+// first group of a regular expression on its link.
+//
+// Image and page links are resolved against the URL of the page they are
+// on, unless linkPrefix or pageURL build the page links.
+type Definition struct {
+	Name        string   `json:"name" yaml:"name"`
+	URL         string   `json:"url" yaml:"url"`
+	ChapterURL  string   `json:"chapterURL" yaml:"chapterURL"`
+	PageURL     string   `json:"pageURL" yaml:"pageURL"`
+	Image       string   `json:"image" yaml:"image"`
+	ImageAttr   string   `json:"imageAttr" yaml:"imageAttr"`
+	PageList    string   `json:"pageList" yaml:"pageList"`
+	PageAttr    string   `json:"pageAttr" yaml:"pageAttr"`
+	LinkPrefix  string   `json:"linkPrefix" yaml:"linkPrefix"`
+	Exclude     []string `json:"exclude" yaml:"exclude"`
+	ParChapters int      `json:"parChapters" yaml:"parChapters"`
+	ParPages    int      `json:"parPages" yaml:"parPages"`
+
+	Headers     map[string]string `json:"headers" yaml:"headers"`
+	RateLimit   RateLimit         `json:"rateLimit" yaml:"rateLimit"`
+	Language    string            `json:"language" yaml:"language"`
+	RightToLeft bool              `json:"rightToLeft" yaml:"rightToLeft"`
+
+	SeriesURL     string `json:"seriesURL" yaml:"seriesURL"`
+	SeriesTitle   string `json:"seriesTitle" yaml:"seriesTitle"`
+	SeriesAuthors string `json:"seriesAuthors" yaml:"seriesAuthors"`
+	SeriesGenres  string `json:"seriesGenres" yaml:"seriesGenres"`
+	SeriesSummary string `json:"seriesSummary" yaml:"seriesSummary"`
+	ChapterList   string `json:"chapterList" yaml:"chapterList"`
+	ChapterLink   string `json:"chapterLink" yaml:"chapterLink"`
+	ChapterTitle  string `json:"chapterTitle" yaml:"chapterTitle"`
+	ChapterDate   string `json:"chapterDate" yaml:"chapterDate"`
+	DateLayout    string `json:"dateLayout" yaml:"dateLayout"`
+	VolumePattern string `json:"volumePattern" yaml:"volumePattern"`
+
+	chapterURL *template.Template
+	pageURL    *template.Template
+	seriesURL  *template.Template
+	volume     *regexp.Regexp
+	limit      fetch.Limit
+}
+
+// RateLimit is the rate of requests a defined site tolerates, see fetch.Limit.
+// The delays are durations such as "500ms".
+type RateLimit struct {
+	Rate     float64 `json:"rate" yaml:"rate"`
+	Burst    int     `json:"burst" yaml:"burst"`
+	MinDelay string  `json:"minDelay" yaml:"minDelay"`
+	Jitter   string  `json:"jitter" yaml:"jitter"`
+}
+
+// URLData is the data available to the URL templates of a Definition
+type URLData struct {
+	URL     string
+	Manga   string
+	Chapter chapter.ID
+	Value   string
+}
+
+// definedSite adapts a Definition to the Site interface
+type definedSite struct {
+	def *Definition
+}
+
+// indexedSite is a definedSite which also implements Indexer
+type indexedSite struct {
+	definedSite
+}
+
+// ParseDefinition decodes a site definition. format is either "json" or
+// "yaml".
+func ParseDefinition(data []byte, format string) (*Definition, error) {
+	def := &Definition{}
+	var err error
+	switch format {
+	case "json":
+		err = json.Unmarshal(data, def)
+	case "yaml":
+		err = yaml.Unmarshal(data, def)
+	default:
+		err = fmt.Errorf("unknown format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	/* check required fields and fill in defaults */
+	if def.ChapterURL == "" || def.Image == "" || def.PageList == "" {
+		return nil, fmt.Errorf("chapterURL, image and pageList are required")
+	}
+	if def.ImageAttr == "" {
+		def.ImageAttr = "src"
+	}
+	if def.PageAttr == "" {
+		def.PageAttr = "value"
+	}
+	if def.ParChapters < 1 {
+		def.ParChapters = 1
+	}
+	if def.ParPages < 1 {
+		def.ParPages = 1
+	}
+
+	/* parse the rate limit */
+	def.limit = fetch.Limit{Rate: def.RateLimit.Rate, Burst: def.RateLimit.Burst}
+	if def.RateLimit.MinDelay != "" {
+		if def.limit.MinDelay, err = time.ParseDuration(def.RateLimit.MinDelay); err != nil {
+			return nil, fmt.Errorf("rateLimit: %v", err)
+		}
+	}
+	if def.RateLimit.Jitter != "" {
+		if def.limit.Jitter, err = time.ParseDuration(def.RateLimit.Jitter); err != nil {
+			return nil, fmt.Errorf("rateLimit: %v", err)
+		}
+	}
+	if def.limit.Rate < 0 || def.limit.MinDelay < 0 || def.limit.Jitter < 0 {
+		return nil, fmt.Errorf("rateLimit: negative rate or delay")
+	}
+
+	/* compile the URL templates */
+	if def.chapterURL, err = template.New("chapterURL").Parse(def.ChapterURL); err != nil {
+		return nil, err
+	}
+	if def.PageURL != "" {
+		if def.pageURL, err = template.New("pageURL").Parse(def.PageURL); err != nil {
+			return nil, err
+		}
+	}
+	if def.SeriesURL != "" {
+		if def.ChapterList == "" {
+			return nil, fmt.Errorf("chapterList is required with seriesURL")
+		}
+		if def.ChapterLink == "" {
+			def.ChapterLink = "a"
+		}
+		if def.seriesURL, err = template.New("seriesURL").Parse(def.SeriesURL); err != nil {
+			return nil, err
+		}
+		if def.VolumePattern != "" {
+			if def.volume, err = regexp.Compile(def.VolumePattern); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	/* check that the templates only use the fields of URLData */
+	sample := URLData{URL: def.URL, Manga: "manga", Chapter: "1", Value: "1"}
+	for _, t := range []*template.Template{def.chapterURL, def.pageURL, def.seriesURL} {
+		if t == nil {
+			continue
+		}
+		if err := t.Execute(ioutil.Discard, sample); err != nil {
+			return nil, err
+		}
+	}
+	return def, nil
+}
+
+// Site returns the Site described by the definition
+func (def *Definition) Site() Site {
+	if def.seriesURL != nil {
+		return indexedSite{definedSite{def}}
+	}
+	return definedSite{def}
+}
+
+// execute returns the URL of a template. The templates are checked when the
+// definition is parsed, an error here returns an empty URL which then fails
+// to download.
+func (d definedSite) execute(t *template.Template, data URLData) string {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		log.Printf("site %s: %v", d.def.Name, err)
+		return ""
+	}
+	return buf.String()
+}
+
+func (d definedSite) ChapterURL(manga string, chapter chapter.ID) string {
+	return d.execute(d.def.chapterURL, URLData{
+		URL:     d.def.URL,
+		Manga:   manga,
+		Chapter: chapter})
+}
+
+func (d definedSite) PageList(manga string, chapter chapter.ID, doc *goquery.Document) []string {
+	var links []string
+	seen := make(map[string]bool)
+	doc.Find(d.def.PageList).Each(func(i int, s *goquery.Selection) {
+		value, found := s.Attr(d.def.PageAttr)
+		if !found || d.excluded(value) {
+			return
+		}
+
+		/* links are relative to the chapter page, unless the definition builds them */
+		link := d.resolve(doc, value)
+		if d.def.LinkPrefix != "" {
+			link = d.def.LinkPrefix + value
+		}
+		if d.def.pageURL != nil {
+			link = d.execute(d.def.pageURL, URLData{
+				URL:     d.def.URL,
+				Manga:   manga,
+				Chapter: chapter,
+				Value:   value})
+		}
+
+		/* page selectors are often repeated at the top and bottom of a page */
+		if !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	})
+	return links
+}
+
+func (d definedSite) excluded(value string) bool {
+	for _, e := range d.def.Exclude {
+		if value == e {
+			return true
+		}
+	}
+	return false
+}
+
+func (d definedSite) Image(doc *goquery.Document) (string, error) {
+	imageURL, found := doc.Find(d.def.Image).Attr(d.def.ImageAttr)
+	if !found {
+		return "", ErrImageNotFound
+	}
+	return d.resolve(doc, imageURL), nil
+}
+
+// resolve returns a link of doc resolved against the URL of doc, or the URL
+// of the site when the document has none
+func (d definedSite) resolve(doc *goquery.Document, link string) string {
+	base := d.def.URL
+	if doc.Url != nil {
+		base = doc.Url.String()
+	}
+	return ResolveURL(base, link)
+}
+
+func (d definedSite) Info() Info {
+	return Info{
+		URL:         d.def.URL,
+		ParChapters: d.def.ParChapters,
+		ParPages:    d.def.ParPages,
+		Headers:     d.def.Headers,
+		Limit:       d.def.limit,
+		Language:    d.def.Language,
+		RightToLeft: d.def.RightToLeft}
+}
+
+func (d indexedSite) SeriesURL(manga string) string {
+	return d.execute(d.def.seriesURL, URLData{
+		URL:   d.def.URL,
+		Manga: manga})
+}
+
+func (d indexedSite) Index(manga string, doc *goquery.Document) (*Series, error) {
+	series := &Series{}
+	if d.def.SeriesTitle != "" {
+		series.Title = strings.TrimSpace(doc.Find(d.def.SeriesTitle).First().Text())
+	}
+	if d.def.SeriesAuthors != "" {
+		series.Authors = Texts(doc.Find(d.def.SeriesAuthors))
+	}
+	if d.def.SeriesGenres != "" {
+		series.Genres = Texts(doc.Find(d.def.SeriesGenres))
+	}
+	if d.def.SeriesSummary != "" {
+		series.Summary = strings.TrimSpace(doc.Find(d.def.SeriesSummary).First().Text())
+	}
+
+	doc.Find(d.def.ChapterList).Each(func(i int, s *goquery.Selection) {
+		link := s.Find(d.def.ChapterLink).First()
+		if s.Is(d.def.ChapterLink) {
+			link = s
+		}
+		href, found := link.Attr("href")
+		if !found {
+			return
+		}
+
+		/* the number is usually in the link text, otherwise in the link itself,
+		and chapters without a number are named after the link text */
+		id, ok := ChapterNumber(link.Text())
+		if !ok {
+			if id, ok = ChapterNumber(href); !ok {
+				id = chapter.Slug(link.Text())
+			}
+		}
+		if id == "" {
+			return
+		}
+
+		c := Chapter{
+			ID:    id,
+			Title: strings.TrimSpace(link.Text()),
+			URL:   ResolveURL(d.def.URL, href)}
+		if d.def.ChapterTitle != "" {
+			c.Title = strings.TrimSpace(s.Find(d.def.ChapterTitle).First().Text())
+		}
+		if d.def.ChapterDate != "" && d.def.DateLayout != "" {
+			c.Date, _ = time.Parse(d.def.DateLayout, strings.TrimSpace(s.Find(d.def.ChapterDate).First().Text()))
+		}
+		if d.def.volume != nil {
+			c.Volume = MatchVolume(d.def.volume, href)
+		}
+		series.Chapters = append(series.Chapters, c)
+	})
+	if len(series.Chapters) == 0 {
+		return nil, fmt.Errorf("no chapters found for %s", manga)
+	}
+
+	SortChapters(series.Chapters)
+	return series, nil
+}
+
+// LoadDir registers every site definition (*.yaml, *.yml, *.json) found in
+// dir. A site is named after its "name" field, or the file name without
+// extension. Definitions replace already registered sites of the same name,
+// so that a broken built-in site can be fixed without recompiling. A missing
+// directory is not an error.
+func LoadDir(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		ext := strings.ToLower(filepath.Ext(file.Name()))
+		var format string
+		switch ext {
+		case ".yaml", ".yml":
+			format = "yaml"
+		case ".json":
+			format = "json"
+		default:
+			continue
+		}
+
+		path := filepath.Join(dir, file.Name())
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		def, err := ParseDefinition(data, format)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if def.Name == "" {
+			def.Name = strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))
+		}
+
+		sitesMu.Lock()
+		if _, dup := sites[def.Name]; dup {
+			log.Println("Site", def.Name, "replaced by", path)
+		}
+		sites[def.Name] = def.Site()
+		sitesMu.Unlock()
+	}
+	return nil
+}
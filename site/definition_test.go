@@ -0,0 +1,240 @@
+package site
+
+import (
+	"io/ioutil"
+	"mangadl/fetch"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var mangafoxYAML = `
+url: http://mangafox.me/manga/
+chapterURL: '{{.URL}}{{.Manga}}/c{{.Chapter.Pad 3}}/1.html'
+pageURL: '{{.URL}}{{.Manga}}/c{{.Chapter.Pad 3}}/{{.Value}}.html'
+image: '#image'
+pageList: 'select.m option'
+exclude: ['0']
+seriesURL: '{{.URL}}{{.Manga}}/'
+seriesTitle: '#title h1'
+chapterList: 'ul.chlist li'
+chapterLink: 'a.tips'
+chapterTitle: 'span.title'
+chapterDate: 'span.date'
+dateLayout: 'Jan 2, 2006'
+volumePattern: '/v(\d+)/c'
+headers:
+  Referer: http://mangafox.me/
+rateLimit: {rate: 2, burst: 4, minDelay: 100ms}
+seriesAuthors: '#title a[href*="/author/"]'
+seriesGenres: '#title a[href*="/genres/"]'
+seriesSummary: '#title p.summary'
+language: en
+rightToLeft: true
+`
+
+var mangareaderJSON = `{
+	"name": "mangareader-json",
+	"url": "http://www.mangareader.net/",
+	"chapterURL": "{{.URL}}{{.Manga}}/{{.Chapter}}/1",
+	"image": "#img",
+	"pageList": "#pageMenu option",
+	"linkPrefix": "http://www.mangareader.net",
+	"parChapters": 6,
+	"parPages": 6
+}`
+
+func TestDefinitionYAML(t *testing.T) {
+	def, err := ParseDefinition([]byte(mangafoxYAML), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := def.Site()
+
+	t.Run("URL", func(t *testing.T) {
+		expect := "http://mangafox.me/manga/naruto/c001/1.html"
+		if got := s.ChapterURL("naruto", "1"); got != expect {
+			t.Errorf("Got: %s, expect: %s", got, expect)
+		}
+		expect = "http://mangafox.me/manga/naruto/c010.5/1.html"
+		if got := s.ChapterURL("naruto", "10.5"); got != expect {
+			t.Errorf("Got: %s, expect: %s", got, expect)
+		}
+	})
+
+	t.Run("Image", func(t *testing.T) {
+		html := `<img src="http://l.mfcdn.net/naruto_v01_ch001_005.jpg" width="671" id="image">`
+		doc, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
+		expect := "http://l.mfcdn.net/naruto_v01_ch001_005.jpg"
+		if got, err := s.Image(doc); err != nil || got != expect {
+			t.Errorf("Got: %s, expect: %s", got, expect)
+		}
+	})
+
+	t.Run("PageList", func(t *testing.T) {
+		html := `
+		<select class="m"><option value="1">1</option><option value="2">2</option><option value="0">Comments</option></select>
+		<select class="m"><option value="1">1</option><option value="2">2</option><option value="0">Comments</option></select>
+		`
+		doc, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
+		expect := []string{
+			"http://mangafox.me/manga/naruto/c001/1.html",
+			"http://mangafox.me/manga/naruto/c001/2.html",
+		}
+		if got := s.PageList("naruto", "1", doc); !reflect.DeepEqual(expect, got) {
+			t.Errorf("Got: %s, expect: %s", got, expect)
+		}
+	})
+
+	t.Run("Index", func(t *testing.T) {
+		html := `
+		<div id="title"><h1>NARUTO</h1>
+		<a href="/search/author/Kishimoto+Masashi/">Kishimoto Masashi</a>
+		<a href="/search/genres/Action/">Action</a>, <a href="/search/genres/Shounen/">Shounen</a>
+		<p class="summary"> Naruto is a young shinobi. </p></div>
+		<ul class="chlist">
+		<li><a href="/manga/naruto/v01/c002/1.html" class="tips">Naruto 2</a> <span class="title">Konohamaru</span> <span class="date">Jul 5, 2009</span></li>
+		<li><a href="/manga/naruto/v01/c001/1.html" class="tips">Naruto 1</a> <span class="title">Uzumaki Naruto</span> <span class="date">Today</span></li>
+		</ul>
+		`
+		doc, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
+		indexer, ok := s.(Indexer)
+		if !ok {
+			t.Fatal("site with seriesURL is not an Indexer")
+		}
+		if got := indexer.SeriesURL("naruto"); got != "http://mangafox.me/manga/naruto/" {
+			t.Errorf("SeriesURL: %s", got)
+		}
+		got, err := indexer.Index("naruto", doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := &Series{
+			Title:   "NARUTO",
+			Authors: []string{"Kishimoto Masashi"},
+			Genres:  []string{"Action", "Shounen"},
+			Summary: "Naruto is a young shinobi.",
+			Chapters: []Chapter{
+				{ID: "1", Title: "Uzumaki Naruto", URL: "http://mangafox.me/manga/naruto/v01/c001/1.html", Volume: "1"},
+				{ID: "2", Title: "Konohamaru", URL: "http://mangafox.me/manga/naruto/v01/c002/1.html", Date: time.Date(2009, 7, 5, 0, 0, 0, 0, time.UTC), Volume: "1"},
+			}}
+		if !reflect.DeepEqual(expect, got) {
+			t.Errorf("Got: %v, expect: %v", got, expect)
+		}
+	})
+
+	t.Run("Info", func(t *testing.T) {
+		expect := Info{
+			URL:         "http://mangafox.me/manga/",
+			ParChapters: 1,
+			ParPages:    1,
+			Headers:     map[string]string{"Referer": "http://mangafox.me/"},
+			Limit:       fetch.Limit{Rate: 2, Burst: 4, MinDelay: 100 * time.Millisecond},
+			Language:    "en",
+			RightToLeft: true}
+		if got := s.Info(); !reflect.DeepEqual(got, expect) {
+			t.Errorf("Got: %v, expect: %v", got, expect)
+		}
+	})
+}
+
+func TestDefinitionJSON(t *testing.T) {
+	def, err := ParseDefinition([]byte(mangareaderJSON), "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := def.Site()
+	if _, ok := s.(Indexer); ok {
+		t.Error("site without seriesURL is an Indexer")
+	}
+
+	expectURL := "http://www.mangareader.net/naruto/1/1"
+	if got := s.ChapterURL("naruto", "1"); got != expectURL {
+		t.Errorf("Got: %s, expect: %s", got, expectURL)
+	}
+
+	html := `<select id="pageMenu"><option value="/naruto/1">1</option><option value="/naruto/1/2">2</option></select>`
+	doc, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
+	expectLinks := []string{
+		"http://www.mangareader.net/naruto/1",
+		"http://www.mangareader.net/naruto/1/2",
+	}
+	if got := s.PageList("naruto", "1", doc); !reflect.DeepEqual(expectLinks, got) {
+		t.Errorf("Got: %s, expect: %s", got, expectLinks)
+	}
+}
+
+func TestDefinitionRelativeLinks(t *testing.T) {
+	def, err := ParseDefinition([]byte(`{"url": "http://example.com/", "chapterURL": "{{.URL}}{{.Manga}}/{{.Chapter}}/", "image": "img", "pageList": "option"}`), "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := def.Site()
+
+	html := `<img src="/img/1-1.jpg"><select><option value="2.html">2</option><option value="http://example.com/naruto/1/3.html">3</option></select>`
+	doc, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
+	doc.Url, _ = url.Parse("http://example.com/naruto/1/1.html")
+
+	expect := "http://example.com/img/1-1.jpg"
+	if got, err := s.Image(doc); err != nil || got != expect {
+		t.Errorf("Got: %s, expect: %s", got, expect)
+	}
+	expectLinks := []string{
+		"http://example.com/naruto/1/2.html",
+		"http://example.com/naruto/1/3.html",
+	}
+	if got := s.PageList("naruto", "1", doc); !reflect.DeepEqual(expectLinks, got) {
+		t.Errorf("Got: %s, expect: %s", got, expectLinks)
+	}
+
+	/* without the URL of the document, links are relative to the site */
+	doc.Url = nil
+	if got, _ := s.Image(doc); got != expect {
+		t.Errorf("Got: %s, expect: %s", got, expect)
+	}
+}
+
+func TestDefinitionInvalid(t *testing.T) {
+	if _, err := ParseDefinition([]byte(`url: http://example.com/`), "yaml"); err == nil {
+		t.Error("definition without selectors accepted")
+	}
+	if _, err := ParseDefinition([]byte(`{"chapterURL": "{{.Manga", "image": "img", "pageList": "option"}`), "json"); err == nil {
+		t.Error("definition with a broken template accepted")
+	}
+	if _, err := ParseDefinition([]byte(`{"chapterURL": "{{.Volume}}", "image": "img", "pageList": "option"}`), "json"); err == nil {
+		t.Error("definition with an unknown template field accepted")
+	}
+	if _, err := ParseDefinition([]byte(`{"chapterURL": "{{.URL}}", "image": "img", "pageList": "option", "rateLimit": {"minDelay": "soon"}}`), "json"); err == nil {
+		t.Error("definition with an invalid delay accepted")
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "fox.yaml"), []byte(mangafoxYAML), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "reader.json"), []byte(mangareaderJSON), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "README.txt"), []byte("not a definition"), 0644)
+
+	if err := LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		delete(sites, "fox")
+		delete(sites, "mangareader-json")
+	}()
+	if _, found := Lookup("fox"); !found {
+		t.Error("site named after its file not registered")
+	}
+	if _, found := Lookup("mangareader-json"); !found {
+		t.Error("site named in its definition not registered")
+	}
+
+	if err := LoadDir(filepath.Join(dir, "missing")); err != nil {
+		t.Error("missing directory:", err)
+	}
+}
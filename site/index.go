@@ -0,0 +1,110 @@
+package site
+
+import (
+	"mangadl/chapter"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Chapter is an entry in the chapter list of a series. Volume is empty when
+// the series page does not tell.
+type Chapter struct {
+	ID     chapter.ID
+	Title  string
+	URL    string
+	Date   time.Time
+	Volume string
+}
+
+// Series is the information scraped from the landing page of a series. The
+// authors, genres and summary are empty when the page does not tell.
+type Series struct {
+	Title    string
+	Authors  []string
+	Genres   []string
+	Summary  string
+	Chapters []Chapter
+}
+
+// Indexer is implemented by sites that can list the chapters of a series
+type Indexer interface {
+	// SeriesURL returns the URL of the landing page of a series
+	SeriesURL(manga string) string
+	// Index scrapes the landing page of a series
+	Index(manga string, doc *goquery.Document) (*Series, error)
+}
+
+var (
+	numberRegexp       = regexp.MustCompile(`\d+(\.\d+)?`)
+	markedNumberRegexp = regexp.MustCompile(`(?i)\b(?:chapter|ch|c)[\s.#_-]*(\d+(?:\.\d+)?)`)
+)
+
+// ChapterNumber returns the number following a chapter, ch or c marker in s,
+// e.g. 12 for "Chapter 12: The 3 Brothers" or 10 for "/naruto/v01/c010/",
+// and otherwise the first number, e.g. 700 for "Naruto 700"
+func ChapterNumber(s string) (chapter.ID, bool) {
+	number := numberRegexp.FindString(s)
+	if match := markedNumberRegexp.FindStringSubmatch(s); match != nil {
+		number = match[1]
+	}
+	if number == "" {
+		return "", false
+	}
+	id, err := chapter.Parse(number)
+	return id, err == nil
+}
+
+// MatchVolume returns the volume matched by the first group of pattern in
+// s, e.g. "1" for pattern `/v(\d+)/` in "/manga/naruto/v01/c001/1.html".
+// Volume numbers are normalized like chapter numbers.
+func MatchVolume(pattern *regexp.Regexp, s string) string {
+	match := pattern.FindStringSubmatch(s)
+	if len(match) < 2 {
+		return ""
+	}
+	volume, err := chapter.Parse(match[1])
+	if err != nil {
+		return ""
+	}
+	return string(volume)
+}
+
+// Texts returns the trimmed, non-empty and distinct texts of the selection,
+// e.g. the authors or genres of a series
+func Texts(s *goquery.Selection) []string {
+	var texts []string
+	seen := make(map[string]bool)
+	s.Each(func(i int, s *goquery.Selection) {
+		text := strings.TrimSpace(s.Text())
+		if text != "" && !seen[text] {
+			seen[text] = true
+			texts = append(texts, text)
+		}
+	})
+	return texts
+}
+
+// SortChapters sorts chapters in the order of chapter.Less
+func SortChapters(chapters []Chapter) {
+	sort.SliceStable(chapters, func(i, j int) bool {
+		return chapter.Less(chapters[i].ID, chapters[j].ID)
+	})
+}
+
+// ResolveURL returns href resolved against base
+func ResolveURL(base, href string) string {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return href
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return href
+	}
+	return baseURL.ResolveReference(ref).String()
+}
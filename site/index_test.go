@@ -0,0 +1,25 @@
+package site
+
+import (
+	"mangadl/chapter"
+	"testing"
+)
+
+func TestChapterNumber(t *testing.T) {
+	for input, expect := range map[string]chapter.ID{
+		"Naruto 700":                 "700",
+		"Naruto 10.5":                "10.5",
+		"/naruto/v01/c010/":          "10",
+		"chapter-3":                  "3",
+		"Chapter 12: The 3 Brothers": "12",
+		"Vol.2 Ch. 15.5":             "15.5",
+		"Epic 5":                     "5",
+	} {
+		if got, ok := ChapterNumber(input); !ok || got != expect {
+			t.Errorf("%s: got %s, expect %s", input, got, expect)
+		}
+	}
+	if _, ok := ChapterNumber("oneshot"); ok {
+		t.Error("number found in oneshot")
+	}
+}
@@ -0,0 +1,81 @@
+package site
+
+import (
+	"errors"
+	"mangadl/chapter"
+	"mangadl/fetch"
+	"sort"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Site is a manga source that can be downloaded from
+type Site interface {
+	// ChapterURL returns the URL of the first page of a chapter
+	ChapterURL(manga string, chapter chapter.ID) string
+	// PageList returns the links to every page of a chapter, given its first page
+	PageList(manga string, chapter chapter.ID, doc *goquery.Document) []string
+	// Image returns the URL of the image in a page
+	Image(doc *goquery.Document) (string, error)
+	// Info returns the site metadata
+	Info() Info
+}
+
+// Info is the metadata of a site. Headers are sent with every request to
+// the site, e.g. a Referer or Cookie some sites require. Limit is the rate
+// of requests the site tolerates, the zero Limit leaves it to the command
+// line. Language is the ISO code of the language of the site, and
+// RightToLeft tells that its pages are read from right to left, as manga.
+type Info struct {
+	URL         string
+	ParChapters int
+	ParPages    int
+	Headers     map[string]string
+	Limit       fetch.Limit
+	Language    string
+	RightToLeft bool
+}
+
+// ErrImageNotFound is returned by Site.Image when a page has no image
+var ErrImageNotFound = errors.New("image not found")
+
+var (
+	sitesMu sync.RWMutex
+	sites   = make(map[string]Site)
+)
+
+// Register makes a site available by name. It is meant to be called from the
+// init function of the package implementing the site, so that a blank import
+// of that package is enough to use it. Register panics if the name is taken.
+func Register(name string, s Site) {
+	sitesMu.Lock()
+	defer sitesMu.Unlock()
+	if s == nil {
+		panic("site: Register site is nil")
+	}
+	if _, dup := sites[name]; dup {
+		panic("site: Register called twice for site " + name)
+	}
+	sites[name] = s
+}
+
+// Lookup returns the site registered under name
+func Lookup(name string) (Site, bool) {
+	sitesMu.RLock()
+	defer sitesMu.RUnlock()
+	s, found := sites[name]
+	return s, found
+}
+
+// Names returns the sorted names of all registered sites
+func Names() []string {
+	sitesMu.RLock()
+	defer sitesMu.RUnlock()
+	var names []string
+	for name := range sites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,42 @@
+package site
+
+import (
+	"mangadl/chapter"
+	"reflect"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+type mocksite struct{}
+
+func (mocksite) ChapterURL(manga string, chapter chapter.ID) string { return "" }
+func (mocksite) PageList(manga string, chapter chapter.ID, doc *goquery.Document) []string {
+	return nil
+}
+func (mocksite) Image(doc *goquery.Document) (string, error) { return "", nil }
+func (mocksite) Info() Info                                  { return Info{} }
+
+func TestRegister(t *testing.T) {
+	Register("mock-b", mocksite{})
+	Register("mock-a", mocksite{})
+
+	if _, found := Lookup("mock-a"); !found {
+		t.Error("registered site not found")
+	}
+	if _, found := Lookup("mock-c"); found {
+		t.Error("unregistered site found")
+	}
+
+	expect := []string{"mock-a", "mock-b"}
+	if got := Names(); !reflect.DeepEqual(expect, got) {
+		t.Errorf("Got: %v, expect: %v", got, expect)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("duplicate Register did not panic")
+		}
+	}()
+	Register("mock-a", mocksite{})
+}
@@ -0,0 +1,96 @@
+package comicextra
+
+import (
+	"fmt"
+	"mangadl/chapter"
+	"mangadl/site"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const baseURL = "http://www.comicextra.com/"
+
+func init() {
+	site.Register("comicextra", comicextra{})
+}
+
+type comicextra struct{}
+
+func (comicextra) ChapterURL(manga string, chapter chapter.ID) string {
+	return fmt.Sprintf(baseURL+"%s/chapter-%s/1", manga, chapter)
+}
+
+func (comicextra) PageList(manga string, chapter chapter.ID, doc *goquery.Document) []string {
+	var links []string
+	doc.Find("select[name=page_select]").Find("option").Each(func(i int, s *goquery.Selection) {
+		if link, found := s.Attr("value"); found == true {
+			links = append(links, link)
+		}
+	})
+	return links
+}
+
+func (comicextra) Image(doc *goquery.Document) (string, error) {
+	imageURL, found := doc.Find("#main_img").Attr("src")
+	if !found {
+		return "", site.ErrImageNotFound
+	}
+	return imageURL, nil
+}
+
+func (comicextra) SeriesURL(manga string) string {
+	return baseURL + "comic/" + manga
+}
+
+func (comicextra) Index(manga string, doc *goquery.Document) (*site.Series, error) {
+	series := &site.Series{
+		Title:   strings.TrimSpace(doc.Find(".movie-detail h1").First().Text()),
+		Authors: site.Texts(detail(doc, "Author:")),
+		Genres:  site.Texts(detail(doc, "Genres:").Find("a")),
+		Summary: strings.TrimSpace(doc.Find("#film-content").First().Text())}
+	doc.Find("#list tr").Each(func(i int, s *goquery.Selection) {
+		link := s.Find("td a").First()
+		href, found := link.Attr("href")
+		if !found {
+			return
+		}
+
+		/* the chapter number is in the link, e.g. "/valerian-and-laureline/chapter-1" */
+		id, ok := site.ChapterNumber(href)
+		if !ok {
+			id = chapter.Slug(link.Text())
+		}
+
+		date, _ := time.Parse("01/02/2006", strings.TrimSpace(s.Find("td").Eq(1).Text()))
+		series.Chapters = append(series.Chapters, site.Chapter{
+			ID:    id,
+			Title: strings.TrimSpace(link.Text()),
+			URL:   site.ResolveURL(baseURL, href),
+			Date:  date})
+	})
+	if len(series.Chapters) == 0 {
+		return nil, fmt.Errorf("no chapters found for %s", manga)
+	}
+
+	/* comicextra lists the newest chapter first */
+	site.SortChapters(series.Chapters)
+	return series, nil
+}
+
+func (comicextra) Info() site.Info {
+	return site.Info{
+		URL:         baseURL,
+		ParChapters: 1,
+		ParPages:    5,
+		Language:    "en"}
+}
+
+// detail returns the value of the series details titled title, e.g.
+// "Author:"
+func detail(doc *goquery.Document, title string) *goquery.Selection {
+	return doc.Find(".movie-dl dt").FilterFunction(func(i int, s *goquery.Selection) bool {
+		return strings.TrimSpace(s.Text()) == title
+	}).Next()
+}
@@ -0,0 +1,96 @@
+package comicextra
+
+import (
+	"fmt"
+	"mangadl/site"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestComicextra(t *testing.T) {
+	t.Run("Image", func(t *testing.T) {
+		/* Image URL */
+		html := `
+		<img id="main_img" class="chapter_img" src="http://2.bp.blogspot.com/g4M04SEdkwl1iGNHuRIq2PvqIdTIKuX5sjGPgVaQQmOJXu793uilskOe6cABXqKfAwy1wi4g-qzE=s0" data-width="820" alt="Valerian and Laureline 1 Page 1" style="width: 100%;">
+		`
+		htmlDocument, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
+		expect := "http://2.bp.blogspot.com/g4M04SEdkwl1iGNHuRIq2PvqIdTIKuX5sjGPgVaQQmOJXu793uilskOe6cABXqKfAwy1wi4g-qzE=s0"
+		got, _ := comicextra{}.Image(htmlDocument)
+		if !reflect.DeepEqual(expect, got) {
+			fmt.Printf("Got: %s\n", got)
+			fmt.Printf("Expect: %s\n", expect)
+			t.Fail()
+		}
+	})
+
+	t.Run("PageList", func(t *testing.T) {
+		/* Page list */
+		html := `
+		<select name="page_select" class="full-select"><option selected="selected">1 </option></select>
+		<select name="page_select" class="full-select"><option value="http://www.comicextra.com/valerian-and-laureline/chapter-1" selected="selected">1 </option><option value="http://www.comicextra.com/valerian-and-laureline/chapter-1/2">2 </option><option value="http://www.comicextra.com/valerian-and-laureline/chapter-1/3">3 </option></select>
+		`
+		htmlDocument, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
+		expectArray := []string{
+			"http://www.comicextra.com/valerian-and-laureline/chapter-1",
+			"http://www.comicextra.com/valerian-and-laureline/chapter-1/2",
+			"http://www.comicextra.com/valerian-and-laureline/chapter-1/3",
+		}
+		gotArray := comicextra{}.PageList("manga", "1", htmlDocument)
+		if !reflect.DeepEqual(expectArray, gotArray) {
+			fmt.Printf("Got: %s\n", gotArray)
+			fmt.Printf("Expect: %s\n", expectArray)
+			t.Fail()
+		}
+	})
+
+	t.Run("URL", func(t *testing.T) {
+		manga := "valerian-and-laureline"
+		got := comicextra{}.ChapterURL(manga, "1")
+		expect := "http://www.comicextra.com/valerian-and-laureline/chapter-1/1"
+		if !reflect.DeepEqual(expect, got) {
+			fmt.Printf("Got: %s\n", got)
+			fmt.Printf("Expect: %s\n", expect)
+			t.Fail()
+		}
+	})
+	t.Run("Index", func(t *testing.T) {
+		/* Series landing page */
+		html := `
+		<div class="movie-detail"><h1>Valerian and Laureline</h1>
+		<dl class="movie-dl"><dt>Status:</dt><dd>Completed</dd><dt>Author:</dt><dd>Pierre Christin</dd>
+		<dt>Genres:</dt><dd><a href="/comic-genre/science-fiction">Science Fiction</a>, <a href="/comic-genre/adventure">Adventure</a></dd></dl></div>
+		<div id="film-content">Spatio-temporal agents Valerian and Laureline travel through space and time.</div>
+		<table id="list">
+		<tr><td><a href="http://www.comicextra.com/valerian-and-laureline/chapter-2">Valerian and Laureline #2</a></td><td>07/05/2009</td></tr>
+		<tr><td><a href="http://www.comicextra.com/valerian-and-laureline/chapter-1">Valerian and Laureline #1</a></td><td>07/04/2009</td></tr>
+		</table>
+		`
+		htmlDocument, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
+		seriesURL := comicextra{}.SeriesURL("valerian-and-laureline")
+		if seriesURL != "http://www.comicextra.com/comic/valerian-and-laureline" {
+			t.Errorf("SeriesURL: %s", seriesURL)
+		}
+		got, err := comicextra{}.Index("valerian-and-laureline", htmlDocument)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := &site.Series{
+			Title:   "Valerian and Laureline",
+			Authors: []string{"Pierre Christin"},
+			Genres:  []string{"Science Fiction", "Adventure"},
+			Summary: "Spatio-temporal agents Valerian and Laureline travel through space and time.",
+			Chapters: []site.Chapter{
+				{ID: "1", Title: "Valerian and Laureline #1", URL: "http://www.comicextra.com/valerian-and-laureline/chapter-1", Date: time.Date(2009, 7, 4, 0, 0, 0, 0, time.UTC)},
+				{ID: "2", Title: "Valerian and Laureline #2", URL: "http://www.comicextra.com/valerian-and-laureline/chapter-2", Date: time.Date(2009, 7, 5, 0, 0, 0, 0, time.UTC)},
+			}}
+		if !reflect.DeepEqual(expect, got) {
+			fmt.Printf("Got: %v\n", got)
+			fmt.Printf("Expect: %v\n", expect)
+			t.Fail()
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package mangafox
+
+import (
+	"fmt"
+	"mangadl/chapter"
+	"mangadl/site"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const baseURL = "http://mangafox.me/manga/"
+
+/* chapter links include the volume, e.g. /manga/naruto/v01/c001/1.html */
+var volumeRegexp = regexp.MustCompile(`/v(\d+)/c`)
+
+func init() {
+	site.Register("mangafox", mangafox{})
+}
+
+type mangafox struct{}
+
+func (mangafox) ChapterURL(manga string, chapter chapter.ID) string {
+	return fmt.Sprintf(baseURL+"%s/c%s/1.html", manga, chapter.Pad(3))
+}
+
+func (mangafox) PageList(manga string, chapter chapter.ID, doc *goquery.Document) []string {
+	var links []string
+	doc.Find("select.m").First().Find("option").Each(func(i int, s *goquery.Selection) {
+		if link, found := s.Attr("value"); found == true {
+			formattedLink := fmt.Sprintf(baseURL+"%s/c%s/%s.html", manga, chapter.Pad(3), link)
+			if link != "0" {
+				links = append(links, formattedLink)
+			}
+		}
+	})
+	return links
+}
+
+func (mangafox) Image(doc *goquery.Document) (string, error) {
+	imageURL, found := doc.Find("#image").Attr("src")
+	if !found {
+		return "", site.ErrImageNotFound
+	}
+	return imageURL, nil
+}
+
+func (mangafox) SeriesURL(manga string) string {
+	return baseURL + manga + "/"
+}
+
+func (mangafox) Index(manga string, doc *goquery.Document) (*site.Series, error) {
+	series := &site.Series{
+		Title:   strings.TrimSpace(doc.Find("#title h1").First().Text()),
+		Authors: site.Texts(doc.Find(`#title a[href*="/author/"], #title a[href*="/artist/"]`)),
+		Genres:  site.Texts(doc.Find(`#title a[href*="/genres/"]`)),
+		Summary: strings.TrimSpace(doc.Find("#title p.summary").First().Text())}
+	doc.Find("ul.chlist li").Each(func(i int, s *goquery.Selection) {
+		link := s.Find("a.tips").First()
+		href, found := link.Attr("href")
+		if !found {
+			return
+		}
+		/* the link has the volume and chapter, e.g. "/manga/naruto/v01/c002/1.html" */
+		id, ok := site.ChapterNumber(href)
+		if !ok {
+			if id, ok = site.ChapterNumber(link.Text()); !ok {
+				id = chapter.Slug(link.Text())
+			}
+		}
+
+		/* dates are "Jul 4, 2009", or "Today" and "Yesterday" for recent chapters */
+		date, _ := time.Parse("Jan 2, 2006", strings.TrimSpace(s.Find("span.date").First().Text()))
+		series.Chapters = append(series.Chapters, site.Chapter{
+			ID:     id,
+			Title:  strings.TrimSpace(s.Find("span.title").First().Text()),
+			URL:    site.ResolveURL(baseURL, href),
+			Date:   date,
+			Volume: site.MatchVolume(volumeRegexp, href)})
+	})
+	if len(series.Chapters) == 0 {
+		return nil, fmt.Errorf("no chapters found for %s", manga)
+	}
+
+	/* mangafox lists the newest chapter first */
+	site.SortChapters(series.Chapters)
+	return series, nil
+}
+
+func (mangafox) Info() site.Info {
+	return site.Info{
+		URL:         baseURL,
+		ParChapters: 1,
+		ParPages:    1,
+		Language:    "en",
+		RightToLeft: true}
+}
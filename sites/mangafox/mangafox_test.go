@@ -0,0 +1,103 @@
+package mangafox
+
+import (
+	"fmt"
+	"mangadl/site"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestMangafox(t *testing.T) {
+	t.Run("Image", func(t *testing.T) {
+		/* Image link */
+		html := `
+		<img src="http://l.mfcdn.net/store/manga/8/01-001.0/compressed/naruto_v01_ch001_005.jpg?token=b0a60425c24cdb15e3a0d5681cd41b188d0d8a59&amp;ttl=1501300800" width="671" id="image" alt="Naruto 1: Uzumaki Naruto at MangaFox.me">
+		`
+		htmlDocument, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
+		expect := "http://l.mfcdn.net/store/manga/8/01-001.0/compressed/naruto_v01_ch001_005.jpg?token=b0a60425c24cdb15e3a0d5681cd41b188d0d8a59&ttl=1501300800"
+		got, _ := mangafox{}.Image(htmlDocument)
+		if !reflect.DeepEqual(expect, got) {
+			fmt.Printf("Got: %s\n", got)
+			fmt.Printf("Expect: %s\n", expect)
+			t.Fail()
+		}
+	})
+
+	t.Run("PageList", func(t *testing.T) {
+		/* Page list */
+		html := `
+		<select onchange="change_page(this)" class="m">
+		<option value="1" selected="selected">1</option><option value="2">2</option><option value="3">3</option><option value="0">Comments</option>
+		</select>
+		<select onchange="change_page(this)" class="m">
+		<option value="1" selected="selected">1</option><option value="2">2</option><option value="3">3</option><option value="0">Comments</option>
+		</select>
+		`
+		htmlDocument, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
+		expect := []string{
+			"http://mangafox.me/manga/naruto/c001/1.html",
+			"http://mangafox.me/manga/naruto/c001/2.html",
+			"http://mangafox.me/manga/naruto/c001/3.html",
+		}
+		got := mangafox{}.PageList("naruto", "1", htmlDocument)
+		if !reflect.DeepEqual(expect, got) {
+			fmt.Printf("Got: %s\n", got)
+			fmt.Printf("Expect: %s\n", expect)
+			t.Fail()
+		}
+	})
+
+	t.Run("URL", func(t *testing.T) {
+		manga := "naruto"
+		got := mangafox{}.ChapterURL(manga, "1")
+		expect := "http://mangafox.me/manga/naruto/c001/1.html"
+		if !reflect.DeepEqual(expect, got) {
+			fmt.Printf("Got: %s\n", got)
+			fmt.Printf("Expect: %s\n", expect)
+			t.Fail()
+		}
+	})
+	t.Run("Index", func(t *testing.T) {
+		/* Series landing page */
+		html := `
+		<div id="title"><h1>NARUTO</h1>
+		<table><tr><th>Released:</th><th>Author(s):</th><th>Artist(s):</th><th>Genre(s):</th></tr>
+		<tr><td><a href="//mangafox.me/search/released/1999/">1999</a></td>
+		<td><a href="//mangafox.me/search/author/Kishimoto+Masashi/">Kishimoto Masashi</a></td>
+		<td><a href="//mangafox.me/search/artist/Kishimoto+Masashi/">Kishimoto Masashi</a></td>
+		<td><a href="//mangafox.me/search/genres/Action/">Action</a>, <a href="//mangafox.me/search/genres/Shounen/">Shounen</a></td></tr></table>
+		<p class="summary">Twelve years ago the Village Hidden in the Leaves was attacked.</p></div>
+		<ul class="chlist">
+		<li><h3><a href="http://mangafox.me/manga/naruto/v01/c002/1.html" class="tips">Naruto 2</a> <span class="title nowrap">Konohamaru</span></h3><span class="date">Jul 5, 2009</span></li>
+		<li><h3><a href="http://mangafox.me/manga/naruto/v01/c001/1.html" class="tips">Naruto 1</a> <span class="title nowrap">Uzumaki Naruto</span></h3><span class="date">Jul 4, 2009</span></li>
+		</ul>
+		`
+		htmlDocument, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
+		seriesURL := mangafox{}.SeriesURL("naruto")
+		if seriesURL != "http://mangafox.me/manga/naruto/" {
+			t.Errorf("SeriesURL: %s", seriesURL)
+		}
+		got, err := mangafox{}.Index("naruto", htmlDocument)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := &site.Series{
+			Title:   "NARUTO",
+			Authors: []string{"Kishimoto Masashi"},
+			Genres:  []string{"Action", "Shounen"},
+			Summary: "Twelve years ago the Village Hidden in the Leaves was attacked.",
+			Chapters: []site.Chapter{
+				{ID: "1", Title: "Uzumaki Naruto", URL: "http://mangafox.me/manga/naruto/v01/c001/1.html", Date: time.Date(2009, 7, 4, 0, 0, 0, 0, time.UTC), Volume: "1"},
+				{ID: "2", Title: "Konohamaru", URL: "http://mangafox.me/manga/naruto/v01/c002/1.html", Date: time.Date(2009, 7, 5, 0, 0, 0, 0, time.UTC), Volume: "1"},
+			}}
+		if !reflect.DeepEqual(expect, got) {
+			fmt.Printf("Got: %v\n", got)
+			fmt.Printf("Expect: %v\n", expect)
+			t.Fail()
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package mangareader
+
+import (
+	"fmt"
+	"mangadl/chapter"
+	"mangadl/fetch"
+	"mangadl/site"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const baseURL = "http://www.mangareader.net/"
+
+func init() {
+	site.Register("mangareader", mangareader{})
+}
+
+type mangareader struct{}
+
+func (mangareader) ChapterURL(manga string, chapter chapter.ID) string {
+	return fmt.Sprintf(baseURL+"%s/%s/1", manga, chapter)
+}
+
+func (mangareader) PageList(manga string, chapter chapter.ID, doc *goquery.Document) []string {
+	var links []string
+	doc.Find("#pageMenu").First().Find("option").Each(func(i int, s *goquery.Selection) {
+		if link, found := s.Attr("value"); found == true {
+			formattedLink := fmt.Sprintf("http://www.mangareader.net%s", link)
+			links = append(links, formattedLink)
+		}
+	})
+	return links
+}
+
+func (mangareader) Image(doc *goquery.Document) (string, error) {
+	imageURL, found := doc.Find("#img").Attr("src")
+	if !found {
+		return "", site.ErrImageNotFound
+	}
+	return imageURL, nil
+}
+
+func (mangareader) SeriesURL(manga string) string {
+	return baseURL + manga
+}
+
+func (mangareader) Index(manga string, doc *goquery.Document) (*site.Series, error) {
+	series := &site.Series{
+		Title:   strings.TrimSpace(doc.Find("h2.aname").First().Text()),
+		Authors: site.Texts(property(doc, "Author:", "Artist:")),
+		Genres:  site.Texts(doc.Find("#mangaproperties span.genretags")),
+		Summary: strings.TrimSpace(doc.Find("#readmangasum p").First().Text())}
+	doc.Find("#listing tr").Each(func(i int, s *goquery.Selection) {
+		link := s.Find("td a").First()
+		href, found := link.Attr("href")
+		if !found {
+			return
+		}
+		id, ok := site.ChapterNumber(link.Text())
+		if !ok {
+			id = chapter.Slug(link.Text())
+		}
+
+		/* the title follows the link text, e.g. "Naruto 1 : Uzumaki Naruto" */
+		title := strings.TrimSpace(link.Parent().Text())
+		title = strings.TrimSpace(strings.TrimPrefix(title, strings.TrimSpace(link.Text())))
+		title = strings.TrimSpace(strings.TrimPrefix(title, ":"))
+
+		date, _ := time.Parse("01/02/2006", strings.TrimSpace(s.Find("td").Eq(1).Text()))
+		series.Chapters = append(series.Chapters, site.Chapter{
+			ID:    id,
+			Title: title,
+			URL:   site.ResolveURL(baseURL, href),
+			Date:  date})
+	})
+	if len(series.Chapters) == 0 {
+		return nil, fmt.Errorf("no chapters found for %s", manga)
+	}
+	return series, nil
+}
+
+func (mangareader) Info() site.Info {
+	return site.Info{
+		URL:         baseURL,
+		ParChapters: 6,
+		ParPages:    6,
+		/* 36 workers unbounded get us banned for a while */
+		Limit:       fetch.Limit{Rate: 4, Burst: 8, Jitter: 100 * time.Millisecond},
+		Language:    "en",
+		RightToLeft: true}
+}
+
+// property returns the values of the rows of the manga properties table
+// titled one of titles, e.g. "Author:"
+func property(doc *goquery.Document, titles ...string) *goquery.Selection {
+	return doc.Find("#mangaproperties td.propertytitle").FilterFunction(func(i int, s *goquery.Selection) bool {
+		title := strings.TrimSpace(s.Text())
+		for _, t := range titles {
+			if title == t {
+				return true
+			}
+		}
+		return false
+	}).Next()
+}
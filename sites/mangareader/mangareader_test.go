@@ -0,0 +1,106 @@
+package mangareader
+
+import (
+	"fmt"
+	"mangadl/site"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestMangareader(t *testing.T) {
+	t.Run("Image", func(t *testing.T) {
+		/* Image URL */
+		html := `
+		<img id="img" width="800" height="1263" src="http://i10.mangareader.net/naruto/1/naruto-1564773.jpg" alt="Naruto 1 - Page 1" name="img">
+		`
+		htmlDocument, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
+		expect := "http://i10.mangareader.net/naruto/1/naruto-1564773.jpg"
+		got, _ := mangareader{}.Image(htmlDocument)
+		if !reflect.DeepEqual(expect, got) {
+			fmt.Printf("Got: %s\n", got)
+			fmt.Printf("Expect: %s\n", expect)
+			t.Fail()
+		}
+	})
+
+	t.Run("PageList", func(t *testing.T) {
+		/* Page list */
+		html := `
+		<select id="pageMenu" name="pageMenu"><option value="/naruto/1" selected="selected">1</option>
+		<option value="/naruto/1/2">2</option>
+		<option value="/naruto/1/3">3</option>
+		</select>
+		<select id="pageMenu" name="pageMenu"><option value="/naruto/1" selected="selected">1</option>
+		<option value="/naruto/1/2">2</option>
+		<option value="/naruto/1/3">3</option>
+		</select>
+		`
+		htmlDocument, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
+		expect := []string{
+			"http://www.mangareader.net/naruto/1",
+			"http://www.mangareader.net/naruto/1/2",
+			"http://www.mangareader.net/naruto/1/3",
+		}
+		got := mangareader{}.PageList("manga", "1", htmlDocument)
+		if !reflect.DeepEqual(expect, got) {
+			fmt.Printf("Got: %s\n", got)
+			fmt.Printf("Expect: %s\n", expect)
+			t.Fail()
+		}
+	})
+
+	t.Run("URL", func(t *testing.T) {
+		manga := "naruto"
+		got := mangareader{}.ChapterURL(manga, "1")
+		expect := "http://www.mangareader.net/naruto/1/1"
+		if !reflect.DeepEqual(expect, got) {
+			fmt.Printf("Got: %s\n", got)
+			fmt.Printf("Expect: %s\n", expect)
+			t.Fail()
+		}
+	})
+	t.Run("Index", func(t *testing.T) {
+		/* Series landing page */
+		html := `
+		<h2 class="aname">Naruto</h2>
+		<div id="mangaproperties"><table>
+		<tr><td class="propertytitle">Author:</td><td>Kishimoto Masashi</td></tr>
+		<tr><td class="propertytitle">Artist:</td><td>Kishimoto Masashi</td></tr>
+		<tr><td class="propertytitle">Genre:</td><td><a><span class="genretags">Action</span></a><a><span class="genretags">Shounen</span></a></td></tr>
+		</table></div>
+		<div id="readmangasum"><h2>Read Naruto Online</h2><p>Twelve years ago the Village Hidden in the Leaves was attacked.</p></div>
+		<table id="listing">
+		<tr class="table_head"><th>Chapter Name</th><th>Date Added</th></tr>
+		<tr><td><a href="/naruto/1">Naruto 1</a> : Uzumaki Naruto</td><td>07/04/2009</td></tr>
+		<tr><td><a href="/naruto/2">Naruto 2</a> : Konohamaru</td><td>07/05/2009</td></tr>
+		</table>
+		`
+		htmlDocument, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
+		seriesURL := mangareader{}.SeriesURL("naruto")
+		if seriesURL != "http://www.mangareader.net/naruto" {
+			t.Errorf("SeriesURL: %s", seriesURL)
+		}
+		got, err := mangareader{}.Index("naruto", htmlDocument)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := &site.Series{
+			Title:   "Naruto",
+			Authors: []string{"Kishimoto Masashi"},
+			Genres:  []string{"Action", "Shounen"},
+			Summary: "Twelve years ago the Village Hidden in the Leaves was attacked.",
+			Chapters: []site.Chapter{
+				{ID: "1", Title: "Uzumaki Naruto", URL: "http://www.mangareader.net/naruto/1", Date: time.Date(2009, 7, 4, 0, 0, 0, 0, time.UTC)},
+				{ID: "2", Title: "Konohamaru", URL: "http://www.mangareader.net/naruto/2", Date: time.Date(2009, 7, 5, 0, 0, 0, 0, time.UTC)},
+			}}
+		if !reflect.DeepEqual(expect, got) {
+			fmt.Printf("Got: %v\n", got)
+			fmt.Printf("Expect: %v\n", expect)
+			t.Fail()
+		}
+	})
+}